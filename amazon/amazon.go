@@ -1,14 +1,7 @@
 package amazon
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-	"sync"
+	"context"
 	"time"
 )
 
@@ -19,19 +12,10 @@ var (
 	HardcoverTypes = []string{"Hardcover", "Leather Bound", "Library Binding", "Flexibound"}
 	DigitalTypes   = []string{"Kindle", "Kindle & Comixology", "Digital"}
 	AudiobookTypes = []string{"Audiobook", "Audible Audiobook", "Audio CD", "MP3 CD"}
-
-	cacheList = map[string]string{}
-	cacheMtx  sync.RWMutex
 )
 
 type ProductData struct {
-	RequestInfo struct {
-		Success                bool      `json:"success"`
-		CreditsUsed            int       `json:"credits_used"`
-		CreditsUsedThisRequest int       `json:"credits_used_this_request"`
-		CreditsRemaining       int       `json:"credits_remaining"`
-		CreditsResetAt         time.Time `json:"credits_reset_at"`
-	} `json:"request_info"`
+	RequestInfo       RequestInfo `json:"request_info"`
 	RequestParameters struct {
 		AmazonDomain string `json:"amazon_domain"`
 		Type         string `json:"type"`
@@ -116,80 +100,28 @@ type ProductData struct {
 			Name  string `json:"name"`
 			Value string `json:"value"`
 		} `json:"attributes"`
-		TopReviews []struct {
-			ID       string `json:"id"`
-			Title    string `json:"title"`
-			Body     string `json:"body"`
-			BodyHTML string `json:"body_html"`
-			Link     string `json:"link,omitempty"`
-			Rating   int    `json:"rating"`
-			Date     struct {
-				Raw string    `json:"raw"`
-				Utc time.Time `json:"utc"`
-			} `json:"date"`
-			Profile struct {
-				Name string `json:"name"`
-				Link string `json:"link"`
-				ID   string `json:"id"`
-			} `json:"profile,omitempty"`
-			VineProgram      bool   `json:"vine_program"`
-			VerifiedPurchase bool   `json:"verified_purchase"`
-			ReviewCountry    string `json:"review_country"`
-			IsGlobalReview   bool   `json:"is_global_review"`
-			HelpfulVotes     int    `json:"helpful_votes,omitempty"`
-			Profile0         struct {
-				Name string `json:"name"`
-			} `json:"profile,omitempty"`
-			Profile1 struct {
-				Name string `json:"name"`
-			} `json:"profile,omitempty"`
-			Profile2 struct {
-				Name string `json:"name"`
-			} `json:"profile,omitempty"`
-			Profile3 struct {
-				Name  string `json:"name"`
-				Image string `json:"image"`
-			} `json:"profile,omitempty"`
-			Profile4 struct {
-				Name string `json:"name"`
-			} `json:"profile,omitempty"`
-		} `json:"top_reviews"`
+		TopReviews   []Review `json:"top_reviews"`
 		BuyboxWinner struct {
 			MaximumOrderQuantity struct {
 				Value       int  `json:"value"`
 				HardMaximum bool `json:"hard_maximum"`
 			} `json:"maximum_order_quantity"`
 			SecondaryBuybox struct {
-				OfferID string `json:"offer_id"`
-				Caption string `json:"caption"`
-				Price   struct {
-					Symbol   string  `json:"symbol"`
-					Value    float64 `json:"value"`
-					Currency string  `json:"currency"`
-					Raw      string  `json:"raw"`
-				} `json:"price"`
+				OfferID      string `json:"offer_id"`
+				Caption      string `json:"caption"`
+				Price        Price  `json:"price"`
 				Availability struct {
 					Raw string `json:"raw"`
 				} `json:"availability"`
 			} `json:"secondary_buybox"`
-			OfferID        string `json:"offer_id"`
-			NewOffersCount int    `json:"new_offers_count"`
-			NewOffersFrom  struct {
-				Value    float64 `json:"value"`
-				Currency string  `json:"currency"`
-				Symbol   string  `json:"symbol"`
-				Raw      string  `json:"raw"`
-			} `json:"new_offers_from"`
-			UsedOffersCount int `json:"used_offers_count"`
-			UsedOffersFrom  struct {
-				Value    float64 `json:"value"`
-				Currency string  `json:"currency"`
-				Symbol   string  `json:"symbol"`
-				Raw      string  `json:"raw"`
-			} `json:"used_offers_from"`
-			IsPrime       bool `json:"is_prime"`
-			IsAmazonFresh bool `json:"is_amazon_fresh"`
-			Condition     struct {
+			OfferID         string `json:"offer_id"`
+			NewOffersCount  int    `json:"new_offers_count"`
+			NewOffersFrom   Price  `json:"new_offers_from"`
+			UsedOffersCount int    `json:"used_offers_count"`
+			UsedOffersFrom  Price  `json:"used_offers_from"`
+			IsPrime         bool   `json:"is_prime"`
+			IsAmazonFresh   bool   `json:"is_amazon_fresh"`
+			Condition       struct {
 				IsNew bool `json:"is_new"`
 			} `json:"condition"`
 			Availability struct {
@@ -213,23 +145,14 @@ type ProductData struct {
 				IsFulfilledByThirdParty bool `json:"is_fulfilled_by_third_party"`
 				IsSoldByThirdParty      bool `json:"is_sold_by_third_party"`
 			} `json:"fulfillment"`
-			Price struct {
-				Symbol   string  `json:"symbol"`
-				Value    float64 `json:"value"`
-				Currency string  `json:"currency"`
-				Raw      string  `json:"raw"`
-			} `json:"price"`
+			Price    Price `json:"price"`
+			Rrp      Price `json:"rrp"`
 			Shipping struct {
 				Raw string `json:"raw"`
 			} `json:"shipping"`
 		} `json:"buybox_winner"`
 		MoreBuyingChoices []struct {
-			Price struct {
-				Symbol   string  `json:"symbol"`
-				Value    float64 `json:"value"`
-				Currency string  `json:"currency"`
-				Raw      string  `json:"raw"`
-			} `json:"price"`
+			Price        Price  `json:"price"`
 			SellerName   string `json:"seller_name"`
 			SellerLink   string `json:"seller_link"`
 			FreeShipping bool   `json:"free_shipping,omitempty"`
@@ -254,22 +177,12 @@ type ProductData struct {
 		BestsellersRankFlat string `json:"bestsellers_rank_flat"`
 	} `json:"product"`
 	FrequentlyBoughtTogether struct {
-		TotalPrice struct {
-			Symbol   string  `json:"symbol"`
-			Value    float64 `json:"value"`
-			Currency string  `json:"currency"`
-			Raw      string  `json:"raw"`
-		} `json:"total_price"`
-		Products []struct {
+		TotalPrice Price `json:"total_price"`
+		Products   []struct {
 			Asin  string `json:"asin"`
 			Title string `json:"title"`
 			Link  string `json:"link"`
-			Price struct {
-				Symbol   string  `json:"symbol"`
-				Value    float64 `json:"value"`
-				Currency string  `json:"currency"`
-				Raw      string  `json:"raw"`
-			} `json:"price"`
+			Price Price  `json:"price"`
 			Image string `json:"image,omitempty"`
 		} `json:"products"`
 	} `json:"frequently_bought_together"`
@@ -280,25 +193,23 @@ type ProductData struct {
 		Image        string  `json:"image"`
 		Rating       float32 `json:"rating"`
 		RatingsTotal float32 `json:"ratings_total"`
-		Price        struct {
-			Symbol   string  `json:"symbol"`
-			Value    float64 `json:"value"`
-			Currency string  `json:"currency"`
-			Raw      string  `json:"raw"`
-		} `json:"price"`
+		Price        Price   `json:"price"`
 	} `json:"also_bought"`
 }
+type RequestInfo struct {
+	Success                bool      `json:"success"`
+	Message                string    `json:"message,omitempty"`
+	CreditsUsed            int       `json:"credits_used"`
+	CreditsUsedThisRequest int       `json:"credits_used_this_request"`
+	CreditsRemaining       int       `json:"credits_remaining"`
+	CreditsResetAt         time.Time `json:"credits_reset_at"`
+}
 type ProductVariant struct {
 	Asin             string `json:"asin"`
 	Link             string `json:"link"`
 	IsCurrentProduct bool   `json:"is_current_product"`
 	Title            string `json:"title"`
-	Price            struct {
-		Symbol   string  `json:"symbol"`
-		Value    float64 `json:"value"`
-		Currency string  `json:"currency"`
-		Raw      string  `json:"raw"`
-	} `json:"price"`
+	Price            Price  `json:"price"`
 }
 
 func (pd ProductData) LookupVariant(titles ...string) (ProductVariant, bool) {
@@ -311,173 +222,54 @@ func (pd ProductData) LookupVariant(titles ...string) (ProductVariant, bool) {
 	}
 	return ProductVariant{}, false
 }
-func init() {
-	cacheList = make(map[string]string)
-	folder := "amazon/current/"
-	matches, _ := filepath.Glob(folder + "/*.json")
-	for _, match := range matches {
-		id := strings.Replace(match, folder, "", 1)
-		id = strings.Replace(id, ".json", "", 1)
-		cacheList[id] = match
-	}
-	f, _ := os.Open("amazon/current/missing.json")
-	missing := []string{}
-	json.NewDecoder(f).Decode(&missing)
-	f.Close()
-	for _, id := range missing {
-		cacheList[id] = "missing"
-	}
-}
-func SaveMissing(id string) {
-	cacheMtx.Lock()
-	cacheList[id] = "missing"
-	f, _ := os.Create("amazon/current/missing.json")
-	missing := []string{}
-	for k, v := range cacheList {
-		if v == "missing" {
-			missing = append(missing, k)
-		}
-	}
-	json.NewEncoder(f).Encode(missing)
-	f.Close()
-	cacheMtx.Unlock()
+func SaveMissing(id string) error {
+	return Default().SaveMissing(id)
 }
-func DropMissing(id string) {
-	cacheMtx.Lock()
-	delete(cacheList, id)
-	f, _ := os.Create("amazon/current/missing.json")
-	missing := []string{}
-	for k, v := range cacheList {
-		if v == "missing" {
-			missing = append(missing, k)
-		}
-	}
-	json.NewEncoder(f).Encode(missing)
-	f.Close()
-	cacheMtx.Unlock()
+func DropMissing(id string) error {
+	return Default().DropMissing(id)
 }
-
-func CacheData(id string, pd ProductData) {
-	filename := fmt.Sprintf("amazon/current/%s.json", id)
-	cacheMtx.Lock()
-	cacheList[id] = filename
-	f, err := os.Create(filename)
-	if err != nil {
-		log.Fatal("Create: ", err)
-	}
-
-	err = json.NewEncoder(f).Encode(pd)
-	if err != nil {
-		log.Fatal("Encode: ", err)
-	}
-	f.Close()
-	cacheMtx.Unlock()
-
-	if pd.Product.Asin != id {
-		CacheData(pd.Product.Asin, pd)
-	}
+func CacheData(id string, pd ProductData) error {
+	return Default().CacheData(id, pd)
 }
-
 func RetrieveASIN(id string, expiration time.Duration) ProductData {
-	cacheMtx.RLock()
-	if cached, ok := cacheList[id]; ok {
-		cacheMtx.RUnlock()
-		if cached == "missing" {
-			return ProductData{}
-		}
-
-		st, _ := os.Stat(cached)
-		if st != nil && time.Since(st.ModTime()) < expiration {
-			f, _ := os.Open(cached)
-			pd := ProductData{}
-			err := json.NewDecoder(f).Decode(&pd)
-			if err != nil {
-				fmt.Println("ID: ", id)
-				log.Fatal("Decode: ", err)
-			}
-			return pd
-		}
-	}
-	cacheMtx.RUnlock()
-
-	u := fmt.Sprintf(
-		"https://api.rainforestapi.com/request?api_key=%s&amazon_domain=amazon.com&asin=%s&type=product",
-		RFAPIKey,
-		id,
-	)
-	pd, err := Get(u)
-	if err != nil {
-		fmt.Println("ID: ", id)
-		log.Fatal("Get: ", err)
-	}
-	if pd.Product.Asin == "" {
-		fmt.Println("Not Found: ", id)
-
-		SaveMissing(id)
-		return ProductData{}
-	}
-	CacheData(id, pd)
-	return pd
+	return Default().RetrieveASIN(id, expiration)
 }
 func RetrieveGTIN(id string, expiration time.Duration) ProductData {
-	id = strings.TrimSpace(strings.ReplaceAll(id, "-", ""))
-	cacheMtx.RLock()
-	if cached, ok := cacheList[id]; ok {
-		cacheMtx.RUnlock()
-		if cached == "missing" {
-			return ProductData{}
-		}
-
-		st, _ := os.Stat(cached)
-		if st != nil && time.Since(st.ModTime()) < expiration {
-			f, _ := os.Open(cached)
-			pd := ProductData{}
-			err := json.NewDecoder(f).Decode(&pd)
-			if err != nil {
-				fmt.Println("ID: ", id)
-				log.Fatal("Decode: ", err)
-			}
-			return pd
-		}
-	}
-	cacheMtx.RUnlock()
-
-	fmt.Println("Not cached: ", id)
-	u := fmt.Sprintf(
-		"https://api.rainforestapi.com/request?api_key=%s&amazon_domain=amazon.com&type=product&gtin=%s",
-		RFAPIKey,
-		id,
-	)
-	pd, err := Get(u)
-	if err != nil {
-		fmt.Println("ID: ", id)
-		log.Fatal("Get: ", err)
-	}
-	if pd.Product.Asin == "" {
-		fmt.Println("Not Found: ", id)
-		SaveMissing(id)
-		return ProductData{}
-	}
-	CacheData(id, pd)
-	return pd
+	return Default().RetrieveGTIN(id, expiration)
+}
+func LookupASIN(id string, expiration time.Duration) (ProductData, error) {
+	return Default().LookupASIN(id, expiration)
+}
+func LookupGTIN(id string, expiration time.Duration) (ProductData, error) {
+	return Default().LookupGTIN(id, expiration)
+}
+func RetrieveMany(ids []string, kind IDKind, expiration time.Duration) []BatchResult {
+	return Default().RetrieveMany(ids, kind, expiration)
+}
+func Search(title, author, publisher string) ([]SearchResult, error) {
+	return Default().Search(title, author, publisher)
 }
-
 func Get(url string) (ProductData, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		fmt.Println("Error: ", err)
-		return ProductData{}, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		fmt.Println("Error: ", resp.StatusCode)
-		return ProductData{}, err
-	}
-	var pd ProductData
-	err = json.NewDecoder(resp.Body).Decode(&pd)
-	if err != nil {
-		fmt.Println("Error: ", err)
-		return ProductData{}, err
-	}
-	return pd, err
+	return Default().Get(url)
+}
+func RetrieveASINContext(ctx context.Context, id string, expiration time.Duration) ProductData {
+	return Default().RetrieveASINContext(ctx, id, expiration)
+}
+func RetrieveGTINContext(ctx context.Context, id string, expiration time.Duration) ProductData {
+	return Default().RetrieveGTINContext(ctx, id, expiration)
+}
+func LookupASINContext(ctx context.Context, id string, expiration time.Duration) (ProductData, error) {
+	return Default().LookupASINContext(ctx, id, expiration)
+}
+func LookupGTINContext(ctx context.Context, id string, expiration time.Duration) (ProductData, error) {
+	return Default().LookupGTINContext(ctx, id, expiration)
+}
+func RetrieveManyContext(ctx context.Context, ids []string, kind IDKind, expiration time.Duration) []BatchResult {
+	return Default().RetrieveManyContext(ctx, ids, kind, expiration)
+}
+func SearchContext(ctx context.Context, title, author, publisher string) ([]SearchResult, error) {
+	return Default().SearchContext(ctx, title, author, publisher)
+}
+func GetContext(ctx context.Context, url string) (ProductData, error) {
+	return Default().GetContext(ctx, url)
 }
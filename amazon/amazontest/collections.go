@@ -0,0 +1,256 @@
+package amazontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+const (
+	collectionsPath = "/collections"
+	downloadsPath   = "/downloads/"
+	// Rainforest takes at most this many requests in a single update.
+	maxCollectionUpdate = 1000
+)
+
+// collection runs its requests as soon as it is started, the next poll
+// still reports it running so clients go through their wait loop.
+type collection struct {
+	amazon.Collection
+	requests []amazon.CollectionRequest
+	results  []amazon.CollectionResult
+	pages    map[int][][]collectionItem
+}
+
+type collectionItem struct {
+	Success bool                     `json:"success"`
+	Result  amazon.ProductData       `json:"result"`
+	Request amazon.CollectionRequest `json:"request"`
+}
+
+type collectionResponse struct {
+	RequestInfo amazon.RequestInfo        `json:"request_info"`
+	Collection  *amazon.Collection        `json:"collection,omitempty"`
+	Results     []amazon.CollectionResult `json:"results,omitempty"`
+}
+
+// Collections lists the collections that have not been deleted.
+func (s *Server) Collections() []amazon.Collection {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	cols := []amazon.Collection{}
+	for _, col := range s.collections {
+		cols = append(cols, col.Collection)
+	}
+	return cols
+}
+
+func (s *Server) serveCollections(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, collectionsPath), "/")
+	parts := strings.Split(path, "/")
+	if path == "" {
+		parts = nil
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		s.createCollection(w, r)
+		return
+	case len(parts) == 0 || len(parts) > 2:
+		writeError(w, http.StatusNotFound, "unknown collections endpoint")
+		return
+	}
+
+	s.mtx.Lock()
+	col, ok := s.collections[parts[0]]
+	s.mtx.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "collection not found")
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.mtx.Lock()
+		resp := collectionResponse{Collection: &amazon.Collection{}}
+		*resp.Collection = col.Collection
+		if col.Status == "running" {
+			col.Status = "idle"
+		}
+		s.mtx.Unlock()
+		s.writeCollection(w, resp)
+	case action == "" && r.Method == http.MethodPut:
+		s.updateCollection(w, r, col)
+	case action == "" && r.Method == http.MethodDelete:
+		s.mtx.Lock()
+		delete(s.collections, col.ID)
+		s.mtx.Unlock()
+		s.writeCollection(w, collectionResponse{})
+	case action == "start" && r.Method == http.MethodGet:
+		s.startCollection(w, r, col)
+	case action == "results" && r.Method == http.MethodGet:
+		s.mtx.Lock()
+		resp := collectionResponse{Results: append([]amazon.CollectionResult{}, col.results...)}
+		s.mtx.Unlock()
+		s.writeCollection(w, resp)
+	default:
+		writeError(w, http.StatusNotFound, "unknown collections endpoint")
+	}
+}
+
+func (s *Server) writeCollection(w http.ResponseWriter, resp collectionResponse) {
+	resp.RequestInfo.Success = true
+	writeJSON(w, resp)
+}
+
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	if json.NewDecoder(r.Body).Decode(&body) != nil || body.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	s.mtx.Lock()
+	s.collected++
+	col := &collection{
+		Collection: amazon.Collection{
+			ID:        fmt.Sprintf("C%04d", s.collected),
+			Name:      body.Name,
+			Status:    "idle",
+			CreatedAt: s.now(),
+		},
+		pages: map[int][][]collectionItem{},
+	}
+	s.collections[col.ID] = col
+	resp := collectionResponse{Collection: &amazon.Collection{}}
+	*resp.Collection = col.Collection
+	s.mtx.Unlock()
+	s.writeCollection(w, resp)
+}
+
+func (s *Server) updateCollection(w http.ResponseWriter, r *http.Request, col *collection) {
+	body := struct {
+		Requests []amazon.CollectionRequest `json:"requests"`
+	}{}
+	if json.NewDecoder(r.Body).Decode(&body) != nil {
+		writeError(w, http.StatusBadRequest, "requests are required")
+		return
+	}
+	if len(body.Requests) > maxCollectionUpdate {
+		writeError(w, http.StatusBadRequest, "at most 1000 requests can be added at once")
+		return
+	}
+	for _, req := range body.Requests {
+		if req.Type != "product" || req.Asin == "" && req.Gtin == "" {
+			writeError(w, http.StatusBadRequest, "only type=product requests with an asin or gtin are supported")
+			return
+		}
+	}
+	s.mtx.Lock()
+	col.requests = append(col.requests, body.Requests...)
+	col.RequestsCount = len(col.requests)
+	resp := collectionResponse{Collection: &amazon.Collection{}}
+	*resp.Collection = col.Collection
+	s.mtx.Unlock()
+	s.writeCollection(w, resp)
+}
+
+func (s *Server) startCollection(w http.ResponseWriter, r *http.Request, col *collection) {
+	s.mtx.Lock()
+	requests := col.requests
+	running := col.Status == "running"
+	s.mtx.Unlock()
+	switch {
+	case running:
+		writeError(w, http.StatusBadRequest, "collection is already running")
+		return
+	case len(requests) == 0:
+		writeError(w, http.StatusBadRequest, "collection has no requests")
+		return
+	}
+
+	result := amazon.CollectionResult{StartedAt: s.now()}
+	items := []collectionItem{}
+	for _, req := range requests {
+		id := req.Asin
+		if id == "" {
+			id = amazon.CleanGTIN(req.Gtin)
+		}
+		item := collectionItem{Success: true, Request: req}
+		var status int
+		item.Result, status = s.product(id, req.AmazonDomain, req.Gtin)
+		if status != 0 {
+			item.Success = false
+			item.Result.RequestInfo.Message = http.StatusText(status)
+			result.RequestsFailed++
+		} else {
+			result.RequestsCompleted++
+		}
+		items = append(items, item)
+	}
+	result.EndedAt = s.now()
+	result.ExpiresAt = result.EndedAt.Add(14 * 24 * time.Hour)
+
+	size := s.PageSize
+	if size <= 0 {
+		size = 1000
+	}
+	pages := [][]collectionItem{}
+	for len(items) > 0 {
+		n := size
+		if n > len(items) {
+			n = len(items)
+		}
+		pages = append(pages, items[:n])
+		items = items[n:]
+	}
+
+	s.mtx.Lock()
+	result.ID = len(col.results) + 1
+	result.PagesCount = len(pages)
+	for i := range pages {
+		result.DownloadLinks.JSON.Pages = append(result.DownloadLinks.JSON.Pages,
+			fmt.Sprintf("http://%s%s%s/%d/%d", r.Host, downloadsPath, col.ID, result.ID, i+1))
+	}
+	col.pages[result.ID] = pages
+	col.results = append(col.results, result)
+	col.Status = "running"
+	col.LastRun = result.StartedAt
+	s.mtx.Unlock()
+	s.writeCollection(w, collectionResponse{})
+}
+
+// serveDownload answers the download links of a run, which like
+// Rainforest's do not need the api_key.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, downloadsPath), "/")
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "unknown download")
+		return
+	}
+	result, err1 := strconv.Atoi(parts[1])
+	page, err2 := strconv.Atoi(parts[2])
+
+	s.mtx.Lock()
+	var items []collectionItem
+	col, ok := s.collections[parts[0]]
+	if ok && err1 == nil && err2 == nil && page >= 1 && page <= len(col.pages[result]) {
+		items = col.pages[result][page-1]
+	}
+	s.mtx.Unlock()
+	if items == nil {
+		writeError(w, http.StatusNotFound, "unknown download")
+		return
+	}
+	writeJSON(w, items)
+}
@@ -0,0 +1,266 @@
+// Package amazontest is a stand-in for the part of the Rainforest API that
+// package amazon uses, type=product lookups by asin or gtin and the
+// collections endpoints, so scrapers can be run end to end without an API
+// key.
+package amazontest
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// Server answers product requests from a directory laid out like an
+// amazon.FileCache, files named for the ASIN or GTIN they answer, gzipped
+// or not, and products added with Add. Ids it has no product for, or that
+// are in the directory's missing.json, get Rainforest's not found answer.
+//
+// Credits are counted like Rainforest does, and once Credits are used up
+// requests fail with a 402. A zero Credits is unlimited, and reports
+// UnlimitedCredits less what has been used as remaining.
+type Server struct {
+	APIKey  string
+	Credits int
+	// ErrorRate and RateLimitRate are the chance of a request failing with
+	// a 500 or a 429.
+	ErrorRate     float64
+	RateLimitRate float64
+	// RetryAfter is sent with 429s, in seconds.
+	RetryAfter int
+	// PageSize is how many results go in each page of a collection run,
+	// zero is Rainforest's 1000.
+	PageSize int
+	Now      func() time.Time
+
+	cache *amazon.FileCache
+
+	mtx         sync.Mutex
+	products    map[string]amazon.ProductData
+	fail        []int
+	failIDs     map[string]int
+	used        int
+	requests    int
+	rand        *rand.Rand
+	collections map[string]*collection
+	collected   int
+}
+
+// UnlimitedCredits is the allowance reported when Credits is zero.
+const UnlimitedCredits = 1000000
+
+// NewServer serves the products in dir, which may be empty to only serve
+// the ones added with Add.
+func NewServer(dir string) *Server {
+	s := &Server{
+		Now:      time.Now,
+		products: map[string]amazon.ProductData{},
+		failIDs:  map[string]int{},
+		rand:     rand.New(rand.NewSource(1)),
+
+		collections: map[string]*collection{},
+	}
+	if dir != "" {
+		s.cache = amazon.NewFileCache(dir)
+	}
+	return s
+}
+
+// Start runs s on a local port, the returned server's URL is the BaseURL
+// to give a Client, and with "/collections" on the end its CollectionsURL.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// Add serves pd for its ASIN and any ISBNs it has.
+func (s *Server) Add(pd amazon.ProductData) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, id := range []string{pd.Product.Asin, pd.Product.Isbn10, pd.Product.Isbn13, pd.RequestParameters.Gtin} {
+		if id != "" {
+			s.products[amazon.CleanGTIN(id)] = pd
+		}
+	}
+}
+
+// Fail makes the next n requests answer with status.
+func (s *Server) Fail(status, n int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		s.fail = append(s.fail, status)
+	}
+}
+
+// FailID makes every request for id answer with status, 0 clears it.
+func (s *Server) FailID(id string, status int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if status == 0 {
+		delete(s.failIDs, id)
+		return
+	}
+	s.failIDs[id] = status
+}
+
+// Requests is how many product requests have been made, including failed
+// ones and the ones run in collections.
+func (s *Server) Requests() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.requests
+}
+
+// CreditsUsed is how many credits the successful requests cost.
+func (s *Server) CreditsUsed() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.used
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case strings.HasPrefix(r.URL.Path, downloadsPath):
+		s.serveDownload(w, r)
+		return
+	case s.APIKey != "" && q.Get("api_key") != s.APIKey:
+		writeError(w, http.StatusUnauthorized, "invalid api_key")
+		return
+	case strings.HasPrefix(r.URL.Path, collectionsPath):
+		s.serveCollections(w, r)
+		return
+	}
+
+	id := q.Get("asin")
+	if id == "" {
+		id = amazon.CleanGTIN(q.Get("gtin"))
+	}
+	switch {
+	case q.Get("type") != "product":
+		writeError(w, http.StatusBadRequest, "only type=product is supported")
+		return
+	case id == "":
+		writeError(w, http.StatusBadRequest, "asin or gtin is required")
+		return
+	}
+
+	pd, status := s.product(id, q.Get("amazon_domain"), q.Get("gtin"))
+	if status != 0 {
+		if status == http.StatusTooManyRequests && s.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		}
+		writeError(w, status, http.StatusText(status))
+		return
+	}
+	writeJSON(w, pd)
+}
+
+// product answers one product request, counting it and its credits. A
+// non zero status is the error the request failed with.
+func (s *Server) product(id, domain, gtin string) (amazon.ProductData, int) {
+	s.mtx.Lock()
+	s.requests++
+	status := s.status(id)
+	if status == 0 && s.Credits > 0 && s.used >= s.Credits {
+		status = http.StatusPaymentRequired
+	}
+	if status == 0 {
+		s.used++
+	}
+	info := amazon.RequestInfo{
+		Success:                true,
+		CreditsUsed:            s.used,
+		CreditsUsedThisRequest: 1,
+		CreditsRemaining:       s.remaining(),
+		CreditsResetAt:         s.resetAt(),
+	}
+	s.mtx.Unlock()
+	if status != 0 {
+		return amazon.ProductData{}, status
+	}
+
+	pd, ok := s.lookup(id)
+	if !ok {
+		info.Success = false
+		info.Message = "product not found for " + id
+		pd = amazon.ProductData{}
+	}
+	pd.RequestInfo = info
+	pd.RequestParameters.AmazonDomain = domain
+	pd.RequestParameters.Type = "product"
+	pd.RequestParameters.Gtin = gtin
+	return pd, 0
+}
+
+// status must be called with mtx held.
+func (s *Server) status(id string) int {
+	if len(s.fail) > 0 {
+		status := s.fail[0]
+		s.fail = s.fail[1:]
+		return status
+	}
+	if status := s.failIDs[id]; status != 0 {
+		return status
+	}
+	switch p := s.rand.Float64(); {
+	case p < s.ErrorRate:
+		return http.StatusInternalServerError
+	case p < s.ErrorRate+s.RateLimitRate:
+		return http.StatusTooManyRequests
+	}
+	return 0
+}
+
+// remaining must be called with mtx held.
+func (s *Server) remaining() int {
+	if s.Credits <= 0 {
+		return UnlimitedCredits - s.used
+	}
+	return s.Credits - s.used
+}
+
+func (s *Server) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (s *Server) resetAt() time.Time {
+	now := s.now()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *Server) lookup(id string) (amazon.ProductData, bool) {
+	s.mtx.Lock()
+	pd, ok := s.products[id]
+	s.mtx.Unlock()
+	if ok || s.cache == nil {
+		return pd, ok
+	}
+	pd, _, err := s.cache.Get(id)
+	return pd, err == nil && pd.Product.Asin != ""
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request_info": map[string]interface{}{
+			"success": false,
+			"message": strings.TrimSpace(message),
+		},
+	})
+}
@@ -0,0 +1,135 @@
+package amazon
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	lockName       = ".lock"
+	quarantineName = "quarantine"
+	tmpPrefix      = ".tmp-"
+)
+
+// writeFileAtomic writes filename through a temp file in the same
+// directory that is renamed over it, readers only ever see the old or the
+// new contents.
+func writeFileAtomic(filename string, write func(io.Writer) error) error {
+	dir := filepath.Dir(filename)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tmpPrefix+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func writeJSONAtomic(filename string, v interface{}, indent bool) error {
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		if indent {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(v)
+	})
+}
+
+// dirLock is an advisory lock on a cache directory, shared by every
+// process using it. Readers take it shared and writers exclusive. Where
+// file locks are not supported it only excludes goroutines in this
+// process.
+type dirLock struct {
+	f *os.File
+}
+
+// lockDir creates dir for an exclusive lock, while a shared lock on a dir
+// that does not exist is nil since there is nothing to read.
+func lockDir(dir string, exclusive bool) (*dirLock, error) {
+	if _, err := os.Stat(dir); !exclusive && os.IsNotExist(err) {
+		return nil, nil
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(f, exclusive)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &dirLock{f: f}, nil
+}
+
+func (l *dirLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// quarantine moves a file that cannot be read into a quarantine directory
+// next to it, so it is out of the way but still there to look at.
+func quarantine(filename string) error {
+	dir := filepath.Join(filepath.Dir(filename), quarantineName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	base := filepath.Base(filename)
+	return os.Rename(filename, filepath.Join(dir, base+"."+time.Now().Format("20060102T150405")))
+}
+
+// quarantineLines copies the unreadable lines of filename into the
+// quarantine directory, leaving filename as it is.
+func quarantineLines(filename string, lines [][]byte) error {
+	dir := filepath.Join(filepath.Dir(filename), quarantineName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, filepath.Base(filename)+"."+time.Now().Format("20060102T150405"))
+	return writeFileAtomic(name, func(w io.Writer) error {
+		for _, line := range lines {
+			_, err := w.Write(line)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isTemp(filename string) bool {
+	return strings.HasPrefix(filepath.Base(filename), tmpPrefix)
+}
@@ -0,0 +1,120 @@
+package amazon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type IDKind int
+
+const (
+	KindASIN IDKind = iota
+	KindGTIN
+)
+
+func (k IDKind) String() string {
+	if k == KindGTIN {
+		return "gtin"
+	}
+	return "asin"
+}
+
+const DefaultWorkers = 4
+
+type BatchResult struct {
+	ID   string
+	Data ProductData
+	Err  error
+}
+
+// RetrieveMany looks up ids with up to Workers requests in flight, the
+// results are in the same order as ids. Lookups for the same id, in this
+// batch or from anywhere else using the client, share a single request.
+func (c *Client) RetrieveMany(ids []string, kind IDKind, expiration time.Duration) []BatchResult {
+	return c.RetrieveManyContext(context.Background(), ids, kind, expiration)
+}
+
+func (c *Client) RetrieveManyContext(ctx context.Context, ids []string, kind IDKind, expiration time.Duration) []BatchResult {
+	workers := c.Workers
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	results := make([]BatchResult, len(ids))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := BatchResult{ID: ids[i]}
+				if err := ctx.Err(); err != nil {
+					r.Err = err
+				} else if kind == KindGTIN {
+					r.Data, r.Err = c.LookupGTINContext(ctx, ids[i], expiration)
+				} else {
+					r.Data, r.Err = c.LookupASINContext(ctx, ids[i], expiration)
+				}
+				results[i] = r
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// flightGroup collapses concurrent calls with the same key into one. The
+// call runs with the context of whoever started it, the others stop
+// waiting when their own context is done, and try again themselves if the
+// call was cancelled out from under them.
+type flightGroup struct {
+	mtx   sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done      chan struct{}
+	pd        ProductData
+	err       error
+	cancelled bool
+}
+
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (ProductData, error)) (ProductData, error) {
+	if g == nil {
+		return fn(ctx)
+	}
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mtx.Unlock()
+		select {
+		case <-ctx.Done():
+			return ProductData{}, ctx.Err()
+		case <-call.done:
+		}
+		if call.cancelled && ctx.Err() == nil {
+			return g.do(ctx, key, fn)
+		}
+		return call.pd, call.err
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mtx.Unlock()
+
+	call.pd, call.err = fn(ctx)
+	call.cancelled = ctx.Err() != nil
+	// removed before done is closed, so waiters trying again after a
+	// cancelled call start a new one rather than finding this one
+	g.mtx.Lock()
+	delete(g.calls, key)
+	g.mtx.Unlock()
+	close(call.done)
+	return call.pd, call.err
+}
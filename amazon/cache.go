@@ -0,0 +1,124 @@
+package amazon
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProductCache stores ProductData by the id it was looked up with, along
+// with the ids Rainforest could not find.
+//
+// Get returns the data and when it was stored. Ids marked missing return
+// a MissingError, which matches ErrNotFound, and ids the cache knows
+// nothing about return ErrNotCached. Caches only store missing entries,
+// deciding when one has expired is up to the Client.
+//
+// Unmark only takes id off the missing list, while Forget drops whatever
+// is stored for it.
+type ProductCache interface {
+	Get(id string) (ProductData, time.Time, error)
+	Put(id string, pd ProductData) error
+	MarkMissing(entry MissingEntry) error
+	Unmark(id string) error
+	Forget(id string) error
+	List() ([]CacheEntry, error)
+}
+
+// CacheEntry has a nil Missing for ids with data.
+type CacheEntry struct {
+	ID      string
+	Updated time.Time
+	Missing *MissingEntry
+}
+
+func sortEntries(entries []CacheEntry) []CacheEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// MemoryCache keeps everything in process, it is mostly useful for tests
+// and short lived tools.
+type MemoryCache struct {
+	Now func() time.Time
+
+	mtx     sync.RWMutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	pd      ProductData
+	missing *MissingEntry
+	updated time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{Now: time.Now, entries: map[string]memoryEntry{}}
+}
+
+func (mc *MemoryCache) now() time.Time {
+	if mc.Now == nil {
+		return time.Now()
+	}
+	return mc.Now()
+}
+
+func (mc *MemoryCache) Get(id string) (ProductData, time.Time, error) {
+	mc.mtx.RLock()
+	defer mc.mtx.RUnlock()
+	e, ok := mc.entries[id]
+	switch {
+	case !ok:
+		return ProductData{}, time.Time{}, ErrNotCached
+	case e.missing != nil:
+		return ProductData{}, e.updated, MissingError{Entry: *e.missing}
+	}
+	return e.pd, e.updated, nil
+}
+
+func (mc *MemoryCache) Put(id string, pd ProductData) error {
+	mc.set(id, memoryEntry{pd: pd, updated: mc.now()})
+	return nil
+}
+
+func (mc *MemoryCache) MarkMissing(entry MissingEntry) error {
+	mc.set(entry.ID, memoryEntry{missing: &entry, updated: entry.MarkedAt})
+	return nil
+}
+
+func (mc *MemoryCache) set(id string, e memoryEntry) {
+	mc.mtx.Lock()
+	if mc.entries == nil {
+		mc.entries = map[string]memoryEntry{}
+	}
+	mc.entries[id] = e
+	mc.mtx.Unlock()
+}
+
+func (mc *MemoryCache) Unmark(id string) error {
+	mc.mtx.Lock()
+	if e, ok := mc.entries[id]; ok && e.missing != nil {
+		delete(mc.entries, id)
+	}
+	mc.mtx.Unlock()
+	return nil
+}
+
+func (mc *MemoryCache) Forget(id string) error {
+	mc.mtx.Lock()
+	delete(mc.entries, id)
+	mc.mtx.Unlock()
+	return nil
+}
+
+func (mc *MemoryCache) List() ([]CacheEntry, error) {
+	mc.mtx.RLock()
+	defer mc.mtx.RUnlock()
+	entries := make([]CacheEntry, 0, len(mc.entries))
+	for id, e := range mc.entries {
+		entries = append(entries, CacheEntry{ID: id, Missing: e.missing, Updated: e.updated})
+	}
+	return sortEntries(entries), nil
+}
@@ -0,0 +1,197 @@
+package amazon_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+func product(asin, title string) amazon.ProductData {
+	var pd amazon.ProductData
+	pd.Product.Asin = asin
+	pd.Product.Title = title
+	return pd
+}
+
+func openKV(t *testing.T, path string) *amazon.KVCache {
+	kv, err := amazon.OpenKVCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+func TestCacheBackends(t *testing.T) {
+	backends := map[string]func(t *testing.T) amazon.ProductCache{
+		"memory": func(t *testing.T) amazon.ProductCache {
+			return amazon.NewMemoryCache()
+		},
+		"file": func(t *testing.T) amazon.ProductCache {
+			return amazon.NewFileCache(t.TempDir())
+		},
+		"gzip file": func(t *testing.T) amazon.ProductCache {
+			fc := amazon.NewFileCache(t.TempDir())
+			fc.Codec = amazon.Gzip
+			return fc
+		},
+		"kv": func(t *testing.T) amazon.ProductCache {
+			kv := openKV(t, filepath.Join(t.TempDir(), "cache.log"))
+			t.Cleanup(func() { kv.Close() })
+			return kv
+		},
+		"monthly": func(t *testing.T) amazon.ProductCache {
+			return amazon.NewMonthlyCache(t.TempDir())
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			cache := open(t)
+			if _, _, err := cache.Get("B000000001"); !errors.Is(err, amazon.ErrNotCached) {
+				t.Fatalf("empty cache: got %v, want ErrNotCached", err)
+			}
+
+			if err := cache.Put("B000000001", product("B000000001", "Volume 1")); err != nil {
+				t.Fatal(err)
+			}
+			pd, _, err := cache.Get("B000000001")
+			if err != nil || pd.Product.Title != "Volume 1" {
+				t.Fatalf("got %q, %v", pd.Product.Title, err)
+			}
+
+			entry := amazon.MissingEntry{ID: "B000000002", Reason: amazon.MissNotFound, MarkedAt: time.Now()}
+			if err := cache.MarkMissing(entry); err != nil {
+				t.Fatal(err)
+			}
+			var missing amazon.MissingError
+			if _, _, err := cache.Get("B000000002"); !errors.As(err, &missing) || !errors.Is(err, amazon.ErrNotFound) {
+				t.Fatalf("missing id: got %v", err)
+			}
+
+			// Unmark only touches the missing list
+			if err := cache.Unmark("B000000001"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := cache.Get("B000000001"); err != nil {
+				t.Errorf("Unmark dropped cached data: %v", err)
+			}
+			if err := cache.Unmark("B000000002"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := cache.Get("B000000002"); !errors.Is(err, amazon.ErrNotCached) {
+				t.Errorf("unmarked id: got %v, want ErrNotCached", err)
+			}
+
+			if err := cache.Forget("B000000001"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := cache.Get("B000000001"); !errors.Is(err, amazon.ErrNotCached) {
+				t.Errorf("forgotten id: got %v, want ErrNotCached", err)
+			}
+			if entries, err := cache.List(); err != nil || len(entries) != 0 {
+				t.Errorf("List after removing everything: %v, %v", entries, err)
+			}
+		})
+	}
+}
+
+func TestKVCacheTruncatesPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	kv := openKV(t, path)
+	for _, id := range []string{"B000000001", "B000000002"} {
+		kv.Put(id, product(id, id))
+	}
+	kv.Close()
+	st, _ := os.Stat(path)
+
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"op":"put","id":"B000000003","data":{"prod`)
+	f.Close()
+
+	kv = openKV(t, path)
+	defer kv.Close()
+	if entries, _ := kv.List(); len(entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(entries))
+	}
+	if after, _ := os.Stat(path); after.Size() != st.Size() {
+		t.Errorf("size %d after reopening, want %d", after.Size(), st.Size())
+	}
+}
+
+func TestKVCacheQuarantinesCorruptLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.log")
+	kv := openKV(t, path)
+	for _, id := range []string{"B000000001", "B000000002", "B000000003"} {
+		kv.Put(id, product(id, id))
+	}
+	kv.Close()
+
+	data, _ := os.ReadFile(path)
+	data[0] = 'X'
+	os.WriteFile(path, data, 0644)
+
+	kv = openKV(t, path)
+	defer kv.Close()
+	if _, _, err := kv.Get("B000000001"); !errors.Is(err, amazon.ErrNotCached) {
+		t.Errorf("corrupt record: got %v, want ErrNotCached", err)
+	}
+	for _, id := range []string{"B000000002", "B000000003"} {
+		if pd, _, err := kv.Get(id); err != nil || pd.Product.Title != id {
+			t.Errorf("%s after a corrupt line: %q, %v", id, pd.Product.Title, err)
+		}
+	}
+	quarantined, _ := filepath.Glob(filepath.Join(dir, "quarantine", "*"))
+	if len(quarantined) != 1 {
+		t.Errorf("got %d quarantined files, want 1", len(quarantined))
+	}
+}
+
+func TestKVCacheCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	kv := openKV(t, path)
+	for i := 0; i < 20; i++ {
+		kv.Put("B000000001", product("B000000001", "Volume 1"))
+	}
+	kv.Put("B000000002", product("B000000002", "Volume 2"))
+	kv.Forget("B000000002")
+	kv.MarkMissing(amazon.MissingEntry{ID: "B000000003", Reason: amazon.MissNotFound})
+	before, _ := os.Stat(path)
+
+	if err := kv.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("compacted size %d, was %d", after.Size(), before.Size())
+	}
+	kv.Put("B000000004", product("B000000004", "Volume 4"))
+	kv.Close()
+
+	kv = openKV(t, path)
+	defer kv.Close()
+	entries, _ := kv.List()
+	if len(entries) != 3 {
+		t.Errorf("got %d entries after reopening, want 3", len(entries))
+	}
+	if pd, _, err := kv.Get("B000000001"); err != nil || pd.Product.Title != "Volume 1" {
+		t.Errorf("got %q, %v", pd.Product.Title, err)
+	}
+	if _, _, err := kv.Get("B000000003"); !errors.Is(err, amazon.ErrNotFound) {
+		t.Errorf("missing entry after compacting: %v", err)
+	}
+}
+
+func TestKVCacheLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	kv := openKV(t, path)
+	if _, err := amazon.OpenKVCache(path); !errors.Is(err, amazon.ErrCacheLocked) {
+		t.Fatalf("second open: got %v, want ErrCacheLocked", err)
+	}
+	kv.Close()
+	kv = openKV(t, path)
+	kv.Close()
+}
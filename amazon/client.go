@@ -0,0 +1,372 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL   = "https://api.rainforestapi.com/request"
+	DefaultCacheRoot = "amazon"
+	// LegacyCacheDir is where the cache lived before MonthlyCache, it is
+	// still read by the default client.
+	LegacyCacheDir = "amazon/current"
+	DefaultTimeout = 90 * time.Second
+)
+
+var (
+	defaultClient *Client
+	defaultCache  *MonthlyCache
+	defaultOnce   sync.Once
+)
+
+// Client holds everything needed to talk to Rainforest and keep a local
+// cache of the results. The zero value is not usable, use NewClient.
+type Client struct {
+	APIKey         string
+	BaseURL        string
+	CollectionsURL string
+	HTTPClient     *http.Client
+	Cache          ProductCache
+	// Marketplace defaults to MarketplaceUS, see In.
+	Marketplace Marketplace
+	// Ledger is optional, when set it is kept up to date and consulted
+	// before each request.
+	Ledger *CreditLedger
+	// History is optional, every product fetched is recorded in it.
+	History *PriceHistory
+	// Limiter may be shared between clients, nil is unlimited.
+	Limiter *RateLimiter
+	Retry   RetryPolicy
+	// Timeout applies to each attempt at a request.
+	Timeout       time.Duration
+	MissingPolicy MissingPolicy
+	// Workers is how many requests RetrieveMany has in flight.
+	Workers int
+	// PollInterval is how often a running collection is checked on.
+	PollInterval time.Duration
+	Now          func() time.Time
+
+	flights *flightGroup
+	hints   *releaseHints
+}
+
+// NewClient returns a client caching into a FileCache in cacheDir.
+func NewClient(apiKey, cacheDir string) *Client {
+	return &Client{
+		APIKey:         apiKey,
+		BaseURL:        DefaultBaseURL,
+		CollectionsURL: DefaultCollectionsURL,
+		HTTPClient:     http.DefaultClient,
+		Cache:          NewFileCache(cacheDir),
+		Retry:          DefaultRetryPolicy,
+		Timeout:        DefaultTimeout,
+		Workers:        DefaultWorkers,
+		PollInterval:   DefaultPollInterval,
+		Now:            time.Now,
+		MissingPolicy:  DefaultMissingPolicy,
+		flights:        &flightGroup{},
+		hints:          &releaseHints{},
+	}
+}
+
+// Default returns the client used by the package level functions. It
+// reads RFAPIKey on every request and caches into a MonthlyCache in
+// DefaultCacheRoot relative to the working directory, gzipped. The cache
+// is read as it is used, scrapers should call RecoverCache before they
+// start writing to it.
+//
+// When RAINFOREST_FIXTURES names a directory, requests are replayed from
+// it by a Recorder, or recorded into it if RAINFOREST_RECORD is set too.
+func Default() *Client {
+	defaultOnce.Do(func() {
+		defaultClient = NewClient("", DefaultCacheRoot)
+		defaultCache = NewMonthlyCache(DefaultCacheRoot)
+		defaultCache.Legacy = LegacyCacheDir
+		defaultCache.Codec = Gzip
+		defaultClient.Cache = defaultCache
+		if dir := os.Getenv("RAINFOREST_FIXTURES"); dir != "" {
+			mode := Replay
+			if os.Getenv("RAINFOREST_RECORD") != "" {
+				mode = Record
+			}
+			defaultClient.HTTPClient = NewRecorder(dir, mode).Client()
+		}
+	})
+	return defaultClient
+}
+
+// RecoverCache runs Recover over this month of the default cache, the only
+// one written to, returning the files quarantined. It reads every file in
+// the month holding the directory lock, so it is for scrapers to call once
+// at startup and not for anything that only reads the cache.
+func RecoverCache() ([]string, error) {
+	return DefaultCache().RecoverCurrent()
+}
+
+// DefaultCache is the cache Default was set up with, for reading the same
+// snapshots the package level functions write.
+func DefaultCache() *MonthlyCache {
+	Default()
+	return defaultCache
+}
+
+func (c *Client) apiKey() string {
+	if c.APIKey == "" {
+		return RFAPIKey
+	}
+	return c.APIKey
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+func (c *Client) record(info RequestInfo) {
+	if c.Ledger == nil {
+		return
+	}
+	err := c.Ledger.Record(info)
+	if err != nil {
+		log.Println("Saving credit ledger: ", err)
+	}
+}
+
+func (c *Client) requestURL(params url.Values) string {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	params.Set("api_key", c.apiKey())
+	return base + "?" + params.Encode()
+}
+
+func (c *Client) SaveMissing(id string) error {
+	return c.MarkMissing(id, MissNotFound, "")
+}
+
+// DropMissing takes id off the missing list so the next lookup asks
+// Rainforest again, any data cached for it is kept.
+func (c *Client) DropMissing(id string) error {
+	return c.Cache.Unmark(id)
+}
+
+// CacheData stores pd under id, and under its own ASIN when it was looked
+// up by something else. The cache does its own locking, so concurrent
+// lookups resolving to the same ASIN only ever replace whole entries.
+func (c *Client) CacheData(id string, pd ProductData) error {
+	err := c.Cache.Put(id, pd)
+	if err != nil {
+		return err
+	}
+	if c.History != nil {
+		err = c.History.Record(pd, c.now())
+		if err != nil {
+			return err
+		}
+	}
+	if pd.Product.Asin != "" && pd.Product.Asin != id {
+		return c.Cache.Put(pd.Product.Asin, pd)
+	}
+	return nil
+}
+
+// LookupASIN is RetrieveASIN with errors returned to the caller instead
+// of ending the process. Products Rainforest does not know about are put
+// on the missing list and reported as ErrNotFound.
+func (c *Client) LookupASIN(id string, expiration time.Duration) (ProductData, error) {
+	return c.LookupASINContext(context.Background(), id, expiration)
+}
+
+// LookupGTIN is the error returning version of RetrieveGTIN.
+func (c *Client) LookupGTIN(id string, expiration time.Duration) (ProductData, error) {
+	return c.LookupGTINContext(context.Background(), id, expiration)
+}
+
+func (c *Client) LookupASINContext(ctx context.Context, id string, expiration time.Duration) (ProductData, error) {
+	return c.lookup(ctx, KindASIN, id, expiration, url.Values{
+		"amazon_domain": {c.marketplace().Domain},
+		"asin":          {id},
+		"type":          {"product"},
+	})
+}
+
+func (c *Client) LookupGTINContext(ctx context.Context, id string, expiration time.Duration) (ProductData, error) {
+	id = CleanGTIN(id)
+	if !ValidGTIN(id) {
+		var missing MissingError
+		if _, _, err := c.Cache.Get(id); errors.As(err, &missing) && missing.Entry.Reason == MissBadGTIN {
+			return ProductData{}, missing
+		}
+		err := c.MarkMissing(id, MissBadGTIN, "check digit does not match")
+		if err != nil {
+			return ProductData{}, err
+		}
+		return ProductData{}, fmt.Errorf("amazon: %s is not a valid GTIN: %w", id, ErrNotFound)
+	}
+	return c.lookup(ctx, KindGTIN, id, expiration, url.Values{
+		"amazon_domain": {c.marketplace().Domain},
+		"type":          {"product"},
+		"gtin":          {id},
+	})
+}
+
+func CleanGTIN(id string) string {
+	return strings.TrimSpace(strings.ReplaceAll(id, "-", ""))
+}
+
+func (c *Client) lookup(ctx context.Context, kind IDKind, id string, expiration time.Duration, params url.Values) (ProductData, error) {
+	key := c.marketplace().Domain + "/" + kind.String() + "/" + id
+	return c.flights.do(ctx, key, func(ctx context.Context) (ProductData, error) {
+		return c.lookupOnce(ctx, id, expiration, params)
+	})
+}
+
+func (c *Client) lookupOnce(ctx context.Context, id string, expiration time.Duration, params url.Values) (ProductData, error) {
+	pd, updated, err := c.Cache.Get(id)
+	var missing MissingError
+	stale := false
+	switch {
+	case errors.Is(err, ErrNotCached), errors.Is(err, ErrCacheCorrupt):
+	case errors.As(err, &missing):
+		if !c.expired(missing.Entry) {
+			return ProductData{}, missing
+		}
+		stale = true
+	case err != nil:
+		return ProductData{}, err
+	case c.now().Sub(updated) < expiration:
+		return pd, nil
+	default:
+		stale = true
+	}
+
+	if c.Ledger != nil {
+		// with the budget or all credits gone, expired data is better
+		// than none
+		err = c.Ledger.Allow(!stale)
+		if stale && (errors.Is(err, ErrBudgetReserve) || errors.Is(err, ErrQuota)) {
+			if missing.Entry.ID != "" {
+				return ProductData{}, missing
+			}
+			return pd, nil
+		}
+		if err != nil {
+			return ProductData{}, fmt.Errorf("amazon: retrieving %s: %w", id, err)
+		}
+	}
+
+	fetched, err := c.GetContext(ctx, c.requestURL(params))
+	if err != nil {
+		// a failed refresh leaves the data we have alone
+		if stale && missing.Entry.ID == "" {
+			return pd, fmt.Errorf("amazon: refreshing %s: %w", id, err)
+		}
+		c.markFailed(id, err)
+		return ProductData{}, fmt.Errorf("amazon: retrieving %s: %w", id, err)
+	}
+	pd = fetched
+	if pd.Product.Asin == "" {
+		err = c.MarkMissing(id, MissNotFound, pd.RequestInfo.Message)
+		if err != nil {
+			return ProductData{}, err
+		}
+		return ProductData{}, ErrNotFound
+	}
+	return pd, c.CacheData(id, pd)
+}
+
+// markFailed puts ids on the missing list for a while when Rainforest
+// keeps failing on them. Problems with the account or the connection are
+// not the id's fault and are left alone. It is only called for ids with no
+// data cached, an api_error entry would hide that data.
+func (c *Client) markFailed(id string, err error) {
+	var status ErrHTTPStatus
+	if !errors.As(err, &status) {
+		return
+	}
+	switch status.Code {
+	case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusTooManyRequests:
+		return
+	}
+	c.MarkMissing(id, MissAPIError, status.Error())
+}
+
+func (c *Client) RetrieveASIN(id string, expiration time.Duration) ProductData {
+	return c.RetrieveASINContext(context.Background(), id, expiration)
+}
+
+func (c *Client) RetrieveGTIN(id string, expiration time.Duration) ProductData {
+	return c.RetrieveGTINContext(context.Background(), id, expiration)
+}
+
+// RetrieveASINContext returns empty ProductData when ctx is done, rather
+// than ending the process like other errors do.
+func (c *Client) RetrieveASINContext(ctx context.Context, id string, expiration time.Duration) ProductData {
+	pd, err := c.LookupASINContext(ctx, id, expiration)
+	return retrieved(ctx, id, pd, err)
+}
+
+func (c *Client) RetrieveGTINContext(ctx context.Context, id string, expiration time.Duration) ProductData {
+	pd, err := c.LookupGTINContext(ctx, id, expiration)
+	return retrieved(ctx, CleanGTIN(id), pd, err)
+}
+
+// retrieved keeps the old behaviour of the Retrieve functions, where
+// anything other than a missing product, a cancelled context or a failed
+// refresh of cached data ends the process.
+func retrieved(ctx context.Context, id string, pd ProductData, err error) ProductData {
+	switch {
+	case err == nil:
+		return pd
+	case pd.Product.Asin != "":
+		log.Println("Using cached data: ", err)
+		return pd
+	case errors.Is(err, ErrNotFound):
+		fmt.Println("Not Found: ", id)
+		return ProductData{}
+	case ctx.Err() != nil:
+		return ProductData{}
+	default:
+		fmt.Println("ID: ", id)
+		log.Fatal(err)
+		return ProductData{}
+	}
+}
+
+func (c *Client) Get(url string) (ProductData, error) {
+	return c.GetContext(context.Background(), url)
+}
+
+func (c *Client) GetContext(ctx context.Context, url string) (ProductData, error) {
+	body, err := c.fetch(ctx, url)
+	if err != nil {
+		return ProductData{}, err
+	}
+	var pd ProductData
+	err = json.Unmarshal(body, &pd)
+	if err != nil {
+		return ProductData{}, fmt.Errorf("amazon: decoding response: %w", err)
+	}
+	c.record(pd.RequestInfo)
+	return pd, nil
+}
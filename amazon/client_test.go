@@ -0,0 +1,154 @@
+package amazon_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+	"github.com/acsellers/ln_shared/amazon/amazontest"
+)
+
+// testClient talks to a fresh stand-in server with a clock the test moves.
+func testClient(t *testing.T) (*amazon.Client, *amazontest.Server, *time.Time) {
+	s := amazontest.NewServer("")
+	s.APIKey = "test-key"
+	ts := s.Start()
+	t.Cleanup(ts.Close)
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := newClient(t, ts.URL)
+	c.Now = func() time.Time { return now }
+	cache := amazon.NewMemoryCache()
+	cache.Now = c.Now
+	c.Cache = cache
+	return c, s, &now
+}
+
+func TestRetrieveASIN(t *testing.T) {
+	c, s, _ := testClient(t)
+	addProduct(s, "B000000001", "Volume 1")
+
+	pd := c.RetrieveASIN("B000000001", time.Hour)
+	if pd.Product.Title != "Volume 1" {
+		t.Fatalf("got %q", pd.Product.Title)
+	}
+	pd = c.RetrieveASIN("B000000001", time.Hour)
+	if pd.Product.Title != "Volume 1" || s.Requests() != 1 {
+		t.Errorf("second lookup: %q after %d requests, want a cache hit", pd.Product.Title, s.Requests())
+	}
+	if report := c.Ledger.Report(); report.CreditsRemaining != amazontest.UnlimitedCredits-1 {
+		t.Errorf("ledger has %d credits remaining", report.CreditsRemaining)
+	}
+}
+
+func TestRetrieveGTIN(t *testing.T) {
+	c, s, _ := testClient(t)
+	var pd amazon.ProductData
+	pd.Product.Asin = "B000000001"
+	pd.Product.Isbn13 = "9780306406157"
+	s.Add(pd)
+
+	got := c.RetrieveGTIN("978-0-306-40615-7", time.Hour)
+	if got.Product.Asin != "B000000001" {
+		t.Fatalf("got %q", got.Product.Asin)
+	}
+	if _, _, err := c.Cache.Get("B000000001"); err != nil {
+		t.Errorf("not cached under its ASIN: %v", err)
+	}
+}
+
+func TestBadGTIN(t *testing.T) {
+	c, s, _ := testClient(t)
+	if pd := c.RetrieveGTIN("978-0-306-40615-8", time.Hour); pd.Product.Asin != "" {
+		t.Fatalf("got %q for a bad GTIN", pd.Product.Asin)
+	}
+	_, err := c.LookupGTIN("9780306406158", time.Hour)
+	var missing amazon.MissingError
+	if !errors.As(err, &missing) || missing.Entry.Reason != amazon.MissBadGTIN {
+		t.Errorf("got %v, want a bad_gtin missing entry", err)
+	}
+	if s.Requests() != 0 {
+		t.Errorf("bad GTINs made %d requests", s.Requests())
+	}
+}
+
+func TestNotFoundExpires(t *testing.T) {
+	c, s, now := testClient(t)
+
+	if pd := c.RetrieveASIN("B000000009", time.Hour); pd.Product.Asin != "" {
+		t.Fatalf("got %q for an unknown ASIN", pd.Product.Asin)
+	}
+	_, err := c.LookupASIN("B000000009", time.Hour)
+	var missing amazon.MissingError
+	if !errors.As(err, &missing) || missing.Entry.Reason != amazon.MissNotFound {
+		t.Fatalf("got %v, want a not_found missing entry", err)
+	}
+	if s.Requests() != 1 {
+		t.Errorf("missing id was requested %d times, want 1", s.Requests())
+	}
+
+	addProduct(s, "B000000009", "Volume 9")
+	*now = now.Add(amazon.DefaultMissingPolicy.TTL - time.Minute)
+	if _, err := c.LookupASIN("B000000009", time.Hour); !errors.Is(err, amazon.ErrNotFound) {
+		t.Errorf("before expiry: got %v, want ErrNotFound", err)
+	}
+	*now = now.Add(2 * time.Minute)
+	pd, err := c.LookupASIN("B000000009", time.Hour)
+	if err != nil || pd.Product.Title != "Volume 9" {
+		t.Errorf("after expiry: got %q, %v", pd.Product.Title, err)
+	}
+	if s.Requests() != 2 {
+		t.Errorf("made %d requests, want 2", s.Requests())
+	}
+
+	if err := c.DropMissing("B000000009"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Cache.Get("B000000009"); err != nil {
+		t.Errorf("DropMissing dropped cached data: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	c, s, now := testClient(t)
+	addProduct(s, "B000000001", "Volume 1")
+
+	s.Fail(http.StatusTooManyRequests, 2)
+	if _, err := c.LookupASIN("B000000001", time.Hour); err != nil {
+		t.Fatalf("after two 429s: %v", err)
+	}
+	if s.Requests() != 3 {
+		t.Errorf("made %d requests, want 3", s.Requests())
+	}
+
+	// a failed refresh serves what is cached and leaves it there
+	*now = now.Add(2 * time.Hour)
+	s.Fail(http.StatusInternalServerError, 3)
+	pd, err := c.LookupASIN("B000000001", time.Hour)
+	var status amazon.ErrHTTPStatus
+	if !errors.As(err, &status) || status.Code != http.StatusInternalServerError || pd.Product.Title != "Volume 1" {
+		t.Errorf("failed refresh: got %q, %v", pd.Product.Title, err)
+	}
+	if pd := c.RetrieveASIN("B000000001", time.Hour); pd.Product.Title != "Volume 1" {
+		t.Errorf("RetrieveASIN after a failed refresh: %q", pd.Product.Title)
+	}
+	if _, _, err := c.Cache.Get("B000000001"); err != nil {
+		t.Errorf("failed refresh hid the cached data: %v", err)
+	}
+
+	// with nothing cached, the id waits out the error TTL
+	requests := s.Requests()
+	s.FailID("B000000002", http.StatusInternalServerError)
+	if _, err := c.LookupASIN("B000000002", time.Hour); !errors.As(err, &status) {
+		t.Fatalf("got %v, want a 500", err)
+	}
+	if got := s.Requests() - requests; got != 3 {
+		t.Errorf("made %d attempts, want 3", got)
+	}
+	var missing amazon.MissingError
+	if _, err := c.LookupASIN("B000000002", time.Hour); !errors.As(err, &missing) || missing.Entry.Reason != amazon.MissAPIError {
+		t.Errorf("got %v, want an api_error missing entry", err)
+	}
+}
@@ -0,0 +1,184 @@
+package amazon
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Codec compresses cache files. Files are named id.json plus Ext, so a
+// cache can tell how each file was written and read a mix of them. Only
+// gzip comes with the package, other formats like zstd can be added by
+// implementing Codec and listing it in Codecs.
+type Codec interface {
+	Ext() string
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	Gzip Codec = gzipCodec{}
+
+	// Codecs are the formats recognised when reading.
+	Codecs = []Codec{Gzip}
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Ext() string { return ".gz" }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// codecFor returns the codec a file name was written with, nil for plain
+// JSON, and false when it is not a cache file at all.
+func codecFor(name string) (Codec, bool) {
+	if strings.HasSuffix(name, ".json") {
+		return nil, true
+	}
+	for _, c := range Codecs {
+		if strings.HasSuffix(name, ".json"+c.Ext()) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func cacheFileID(name string) string {
+	name = filepath.Base(name)
+	if c, ok := codecFor(name); ok && c != nil {
+		name = strings.TrimSuffix(name, c.Ext())
+	}
+	return strings.TrimSuffix(name, ".json")
+}
+
+func cacheFileName(id string, c Codec) string {
+	if c == nil {
+		return id + ".json"
+	}
+	return id + ".json" + c.Ext()
+}
+
+func encodeProduct(w io.Writer, c Codec, pd ProductData) error {
+	if c == nil {
+		return json.NewEncoder(w).Encode(pd)
+	}
+	cw := c.NewWriter(w)
+	err := json.NewEncoder(cw).Encode(pd)
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func decodeProduct(r io.Reader, c Codec) (ProductData, error) {
+	pd := ProductData{}
+	if c != nil {
+		cr, err := c.NewReader(r)
+		if err != nil {
+			return pd, err
+		}
+		defer cr.Close()
+		r = cr
+	}
+	err := json.NewDecoder(r).Decode(&pd)
+	return pd, err
+}
+
+func readProductFile(filename string) (ProductData, error) {
+	c, _ := codecFor(filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return ProductData{}, err
+	}
+	defer f.Close()
+	return decodeProduct(f, c)
+}
+
+// Slim drops what the pipeline never reads, the review text, image lists,
+// keywords and other sellers' offers. Ratings, ranks, prices, formats,
+// specifications and the also bought ASINs are kept. pd is left as it was.
+func (pd ProductData) Slim() ProductData {
+	p := &pd.Product
+	p.Keywords = ""
+	p.KeywordsList = nil
+	p.EditorialReviews = nil
+	p.EditorialReviewsFlat = ""
+	p.Images = nil
+	p.ImagesFlat = ""
+	p.Attributes = nil
+	p.TopReviews = nil
+	p.MoreBuyingChoices = nil
+	p.SpecificationsFlat = ""
+	// the slices still share their arrays with the caller's copy
+	pd.FrequentlyBoughtTogether.Products = append(pd.FrequentlyBoughtTogether.Products[:0:0], pd.FrequentlyBoughtTogether.Products...)
+	pd.AlsoBought = append(pd.AlsoBought[:0:0], pd.AlsoBought...)
+	for i := range pd.FrequentlyBoughtTogether.Products {
+		pd.FrequentlyBoughtTogether.Products[i].Image = ""
+	}
+	for i := range pd.AlsoBought {
+		pd.AlsoBought[i].Image = ""
+		pd.AlsoBought[i].Link = ""
+	}
+	return pd
+}
+
+// MigrateCache rewrites every cached product under dir, including month
+// and marketplace subdirectories, with codec, which may be nil for plain
+// JSON, and slimmed when slim is set. Modification times are kept since
+// they are when the data was fetched. It returns how many files were
+// rewritten.
+func MigrateCache(dir string, codec Codec, slim bool) (int, error) {
+	n := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == quarantineName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		from, ok := codecFor(info.Name())
+		if !ok || isTemp(path) || cacheFileID(path) == "missing" {
+			return nil
+		}
+		if from == codec && !slim {
+			return nil
+		}
+
+		pd, err := readProductFile(path)
+		if err != nil {
+			// left for Recover to quarantine
+			return nil
+		}
+		if slim {
+			pd = pd.Slim()
+		}
+		target := filepath.Join(filepath.Dir(path), cacheFileName(cacheFileID(path), codec))
+		err = writeFileAtomic(target, func(w io.Writer) error {
+			return encodeProduct(w, codec, pd)
+		})
+		if err == nil {
+			err = os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		if err == nil && target != path {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,331 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCollectionsURL = "https://api.rainforestapi.com/collections"
+	DefaultPollInterval   = 30 * time.Second
+
+	// Rainforest takes at most this many requests in a single update.
+	collectionBatchSize = 1000
+)
+
+var ErrCollectionFailed = errors.New("amazon: collection run failed")
+
+// Collection is a saved list of requests Rainforest runs in bulk, the
+// results are downloaded as pages of JSON once the run has finished.
+type Collection struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Status        string    `json:"status"`
+	RequestsCount int       `json:"requests_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastRun       time.Time `json:"last_run"`
+}
+
+type CollectionResult struct {
+	ID                int       `json:"id"`
+	StartedAt         time.Time `json:"started_at"`
+	EndedAt           time.Time `json:"ended_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	RequestsCompleted int       `json:"requests_completed"`
+	RequestsFailed    int       `json:"requests_failed"`
+	PagesCount        int       `json:"pages_count"`
+	DownloadLinks     struct {
+		JSON struct {
+			Pages    []string `json:"pages"`
+			AllPages string   `json:"all_pages"`
+		} `json:"json"`
+	} `json:"download_links"`
+}
+
+type CollectionRequest struct {
+	Type         string `json:"type"`
+	AmazonDomain string `json:"amazon_domain"`
+	Asin         string `json:"asin,omitempty"`
+	Gtin         string `json:"gtin,omitempty"`
+	CustomID     string `json:"custom_id,omitempty"`
+}
+
+// collectionItem is one entry in a downloaded result page.
+type collectionItem struct {
+	Success bool              `json:"success"`
+	Result  ProductData       `json:"result"`
+	Request CollectionRequest `json:"request"`
+}
+
+type collectionResponse struct {
+	RequestInfo RequestInfo        `json:"request_info"`
+	Collection  Collection         `json:"collection"`
+	Results     []CollectionResult `json:"results"`
+}
+
+func (c *Client) collectionURL(path ...string) string {
+	base := c.CollectionsURL
+	if base == "" {
+		base = DefaultCollectionsURL
+	}
+	u := strings.Join(append([]string{strings.TrimSuffix(base, "/")}, path...), "/")
+	return u + "?" + url.Values{"api_key": {c.apiKey()}}.Encode()
+}
+
+// collectionCall sends a request to the collections API, retrying only
+// when retry is set.
+func (c *Client) collectionCall(ctx context.Context, method string, retry bool, body interface{}, path ...string) (collectionResponse, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return collectionResponse{}, err
+		}
+	}
+	resp, err := c.send(ctx, method, c.collectionURL(path...), data, retry)
+	if err != nil {
+		return collectionResponse{}, err
+	}
+	var cr collectionResponse
+	err = json.Unmarshal(resp, &cr)
+	if err != nil {
+		return collectionResponse{}, fmt.Errorf("amazon: decoding collection response: %w", err)
+	}
+	if !cr.RequestInfo.Success && cr.RequestInfo.Message != "" {
+		return cr, fmt.Errorf("amazon: collection request failed: %s", cr.RequestInfo.Message)
+	}
+	return cr, nil
+}
+
+func (c *Client) CreateCollection(name string) (Collection, error) {
+	return c.CreateCollectionContext(context.Background(), name)
+}
+
+func (c *Client) CreateCollectionContext(ctx context.Context, name string) (Collection, error) {
+	cr, err := c.collectionCall(ctx, http.MethodPost, false, map[string]interface{}{
+		"name":          name,
+		"enabled":       true,
+		"schedule_type": "manual",
+		"priority":      "normal",
+	})
+	return cr.Collection, err
+}
+
+// AddToCollection adds a product request for each id in the client's
+// marketplace. The id is sent as the custom_id so results can be cached
+// under the id they were asked for.
+func (c *Client) AddToCollection(collectionID string, ids []string, kind IDKind) error {
+	return c.AddToCollectionContext(context.Background(), collectionID, ids, kind)
+}
+
+func (c *Client) AddToCollectionContext(ctx context.Context, collectionID string, ids []string, kind IDKind) error {
+	requests := make([]CollectionRequest, 0, len(ids))
+	for _, id := range ids {
+		req := CollectionRequest{Type: "product", AmazonDomain: c.marketplace().Domain}
+		if kind == KindGTIN {
+			id = CleanGTIN(id)
+			req.Gtin = id
+		} else {
+			req.Asin = id
+		}
+		req.CustomID = id
+		requests = append(requests, req)
+	}
+	for len(requests) > 0 {
+		n := collectionBatchSize
+		if n > len(requests) {
+			n = len(requests)
+		}
+		_, err := c.collectionCall(ctx, http.MethodPut, false, map[string]interface{}{"requests": requests[:n]}, collectionID)
+		if err != nil {
+			return err
+		}
+		requests = requests[n:]
+	}
+	return nil
+}
+
+func (c *Client) StartCollection(collectionID string) error {
+	return c.StartCollectionContext(context.Background(), collectionID)
+}
+
+// StartCollectionContext checks the collection's request count against
+// the ledger first, a run is a refresh so it may not dip into the reserve.
+func (c *Client) StartCollectionContext(ctx context.Context, collectionID string) error {
+	if c.Ledger != nil {
+		col, err := c.GetCollectionContext(ctx, collectionID)
+		if err != nil {
+			return err
+		}
+		err = c.Ledger.AllowN(col.RequestsCount, false)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.collectionCall(ctx, http.MethodGet, false, nil, collectionID, "start")
+	return err
+}
+
+func (c *Client) GetCollection(collectionID string) (Collection, error) {
+	return c.GetCollectionContext(context.Background(), collectionID)
+}
+
+func (c *Client) GetCollectionContext(ctx context.Context, collectionID string) (Collection, error) {
+	cr, err := c.collectionCall(ctx, http.MethodGet, true, nil, collectionID)
+	return cr.Collection, err
+}
+
+func (c *Client) CollectionResults(collectionID string) ([]CollectionResult, error) {
+	return c.CollectionResultsContext(context.Background(), collectionID)
+}
+
+func (c *Client) CollectionResultsContext(ctx context.Context, collectionID string) ([]CollectionResult, error) {
+	cr, err := c.collectionCall(ctx, http.MethodGet, true, nil, collectionID, "results")
+	return cr.Results, err
+}
+
+func (c *Client) DeleteCollection(collectionID string) error {
+	return c.DeleteCollectionContext(context.Background(), collectionID)
+}
+
+func (c *Client) DeleteCollectionContext(ctx context.Context, collectionID string) error {
+	_, err := c.collectionCall(ctx, http.MethodDelete, true, nil, collectionID)
+	return err
+}
+
+// WaitCollection polls every PollInterval until a finished run with a
+// result id above after shows up, pass the highest id seen before the run
+// was started.
+func (c *Client) WaitCollection(collectionID string, after int) (CollectionResult, error) {
+	return c.WaitCollectionContext(context.Background(), collectionID, after)
+}
+
+func (c *Client) WaitCollectionContext(ctx context.Context, collectionID string, after int) (CollectionResult, error) {
+	poll := c.PollInterval
+	if poll <= 0 {
+		poll = DefaultPollInterval
+	}
+	for {
+		cr, err := c.collectionCall(ctx, http.MethodGet, true, nil, collectionID)
+		if err != nil {
+			return CollectionResult{}, err
+		}
+		if cr.Collection.Status == "idle" {
+			results, err := c.CollectionResultsContext(ctx, collectionID)
+			if err != nil {
+				return CollectionResult{}, err
+			}
+			for _, r := range results {
+				if r.ID > after && !r.EndedAt.IsZero() {
+					return r, nil
+				}
+			}
+		}
+		err = sleep(ctx, poll)
+		if err != nil {
+			return CollectionResult{}, err
+		}
+	}
+}
+
+// ImportCollectionResult downloads every page of a finished run and feeds
+// each product through CacheData, or onto the missing list when Rainforest
+// found nothing. Requests that failed in the run are marked as API errors,
+// which expire sooner, unless there is data cached for them already. Failures to update the cache are in each result's
+// Err and the first is returned once every page is imported.
+func (c *Client) ImportCollectionResult(result CollectionResult) ([]BatchResult, error) {
+	return c.ImportCollectionResultContext(context.Background(), result)
+}
+
+func (c *Client) ImportCollectionResultContext(ctx context.Context, result CollectionResult) ([]BatchResult, error) {
+	imported := []BatchResult{}
+	var cacheErr error
+	for _, page := range result.DownloadLinks.JSON.Pages {
+		data, err := c.fetch(ctx, page)
+		if err != nil {
+			return imported, fmt.Errorf("amazon: downloading %s: %w", page, err)
+		}
+		items := []collectionItem{}
+		err = json.Unmarshal(data, &items)
+		if err != nil {
+			return imported, fmt.Errorf("amazon: decoding %s: %w", page, err)
+		}
+		for _, item := range items {
+			id := item.Request.CustomID
+			if id == "" {
+				id = item.Request.Asin + item.Request.Gtin
+			}
+			c.record(item.Result.RequestInfo)
+			br := BatchResult{ID: id, Data: item.Result}
+			var err error
+			switch {
+			case !item.Success:
+				// data already cached is kept and returned as it was
+				br.Err = ErrCollectionFailed
+				cached, _, cerr := c.Cache.Get(id)
+				br.Data = cached
+				if cerr != nil {
+					err = c.MarkMissing(id, MissAPIError, item.Result.RequestInfo.Message)
+				}
+			case item.Result.Product.Asin == "":
+				br.Data = ProductData{}
+				br.Err = ErrNotFound
+				err = c.SaveMissing(id)
+			default:
+				err = c.CacheData(id, item.Result)
+			}
+			if err != nil {
+				br.Err = err
+				if cacheErr == nil {
+					cacheErr = err
+				}
+			}
+			imported = append(imported, br)
+		}
+	}
+	return imported, cacheErr
+}
+
+// RefreshCollection runs the whole bulk workflow for ids: a temporary
+// collection is created, filled, run, waited on, imported and deleted.
+func (c *Client) RefreshCollection(name string, ids []string, kind IDKind) ([]BatchResult, error) {
+	return c.RefreshCollectionContext(context.Background(), name, ids, kind)
+}
+
+func (c *Client) RefreshCollectionContext(ctx context.Context, name string, ids []string, kind IDKind) ([]BatchResult, error) {
+	if c.Ledger != nil {
+		err := c.Ledger.AllowN(len(ids), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	col, err := c.CreateCollectionContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer c.DeleteCollectionContext(context.Background(), col.ID)
+
+	err = c.AddToCollectionContext(ctx, col.ID, ids, kind)
+	if err != nil {
+		return nil, err
+	}
+	err = c.StartCollectionContext(ctx, col.ID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.WaitCollectionContext(ctx, col.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if result.RequestsCompleted == 0 && result.RequestsFailed > 0 {
+		return nil, fmt.Errorf("%w: %d requests failed", ErrCollectionFailed, result.RequestsFailed)
+	}
+	return c.ImportCollectionResultContext(ctx, result)
+}
@@ -0,0 +1,153 @@
+package amazon_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+	"github.com/acsellers/ln_shared/amazon/amazontest"
+)
+
+func collectionClient(t *testing.T) (*amazon.Client, *amazontest.Server) {
+	s := amazontest.NewServer("")
+	s.APIKey = "test-key"
+	s.PageSize = 2
+	ts := s.Start()
+	t.Cleanup(ts.Close)
+	return newClient(t, ts.URL), s
+}
+
+func newClient(t *testing.T, url string) *amazon.Client {
+	c := amazon.NewClient("test-key", t.TempDir())
+	c.Cache = amazon.NewMemoryCache()
+	c.BaseURL = url + "/request"
+	c.CollectionsURL = url + "/collections"
+	c.PollInterval = time.Millisecond
+	c.Retry = amazon.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	ledger, err := amazon.OpenCreditLedger("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Ledger = ledger
+	return c
+}
+
+func addProduct(s *amazontest.Server, asin, title string) {
+	var pd amazon.ProductData
+	pd.Product.Asin = asin
+	pd.Product.Title = title
+	s.Add(pd)
+}
+
+func TestRefreshCollection(t *testing.T) {
+	c, s := collectionClient(t)
+	addProduct(s, "B000000001", "Volume 1")
+	addProduct(s, "B000000002", "Volume 2")
+	addProduct(s, "B000000004", "Volume 4")
+	s.FailID("B000000004", http.StatusInternalServerError)
+
+	ids := []string{"B000000001", "B000000002", "B000000003", "B000000004"}
+	results, err := c.RefreshCollection("refresh", ids, amazon.KindASIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(ids) {
+		t.Fatalf("got %d results, want %d", len(results), len(ids))
+	}
+	byID := map[string]amazon.BatchResult{}
+	for _, br := range results {
+		byID[br.ID] = br
+	}
+
+	for _, id := range ids[:2] {
+		if err := byID[id].Err; err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+		pd, _, err := c.Cache.Get(id)
+		if err != nil || pd.Product.Asin != id {
+			t.Errorf("%s not cached: %v", id, err)
+		}
+	}
+
+	var missing amazon.MissingError
+	if !errors.Is(byID["B000000003"].Err, amazon.ErrNotFound) {
+		t.Errorf("B000000003: got %v, want ErrNotFound", byID["B000000003"].Err)
+	}
+	if _, _, err := c.Cache.Get("B000000003"); !errors.As(err, &missing) || missing.Entry.Reason != amazon.MissNotFound {
+		t.Errorf("B000000003 should be missing as not found, got %v", err)
+	}
+	if !errors.Is(byID["B000000004"].Err, amazon.ErrCollectionFailed) {
+		t.Errorf("B000000004: got %v, want ErrCollectionFailed", byID["B000000004"].Err)
+	}
+	if _, _, err := c.Cache.Get("B000000004"); !errors.As(err, &missing) || missing.Entry.Reason != amazon.MissAPIError {
+		t.Errorf("B000000004 should be missing as an API error, got %v", err)
+	}
+
+	if cols := s.Collections(); len(cols) != 0 {
+		t.Errorf("collection was not deleted: %v", cols)
+	}
+	report := c.Ledger.Report()
+	if !report.Known || report.RunCredits != s.CreditsUsed() {
+		t.Errorf("ledger saw %d credits, server charged %d", report.RunCredits, s.CreditsUsed())
+	}
+}
+
+func TestRefreshCollectionReserve(t *testing.T) {
+	c, s := collectionClient(t)
+	addProduct(s, "B000000001", "Volume 1")
+	_, err := c.LookupASIN("B000000001", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := c.Ledger.Report().CreditsRemaining
+	c.Ledger.Reserve = remaining - 1
+	requests := s.Requests()
+	_, err = c.RefreshCollection("refresh", []string{"B000000001", "B000000002"}, amazon.KindASIN)
+	if !errors.Is(err, amazon.ErrBudgetReserve) {
+		t.Fatalf("got %v, want ErrBudgetReserve", err)
+	}
+	if s.Requests() != requests || len(s.Collections()) != 0 {
+		t.Error("refused refresh still reached the server")
+	}
+}
+
+func TestCollectionUpdatesNotRetried(t *testing.T) {
+	s := amazontest.NewServer("")
+	var mtx sync.Mutex
+	updates := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost || r.Method == http.MethodPut || strings.HasSuffix(r.URL.Path, "/start") {
+			mtx.Lock()
+			updates++
+			mtx.Unlock()
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c := newClient(t, ts.URL)
+	_, err := c.CreateCollection("refresh")
+	if err == nil {
+		t.Fatal("create should have failed")
+	}
+	err = c.AddToCollection("C0001", []string{"B000000001"}, amazon.KindASIN)
+	if err == nil {
+		t.Fatal("update should have failed")
+	}
+	c.Ledger = nil
+	err = c.StartCollection("C0001")
+	if err == nil {
+		t.Fatal("start should have failed")
+	}
+	if updates != 3 {
+		t.Errorf("sent %d create, update and start requests, want 3", updates)
+	}
+}
@@ -0,0 +1,212 @@
+package amazon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrBudgetReserve = errors.New("amazon: rainforest credits are down to the reserve")
+
+// CreditLedger follows the credit counters Rainforest sends back with each
+// response and persists them to Path so the next run starts out knowing
+// where the account stands.
+//
+// Once CreditsRemaining is at or below Reserve only essential lookups are
+// allowed. Client treats fetching something it has never seen as
+// essential, and refreshing an expired cache entry as something that can
+// wait, serving the expired entry instead.
+type CreditLedger struct {
+	Path    string
+	Reserve int
+	Now     func() time.Time
+
+	mtx   sync.Mutex
+	state ledgerState
+	run   runCounts
+}
+
+type ledgerState struct {
+	CreditsUsed      int       `json:"credits_used"`
+	CreditsRemaining int       `json:"credits_remaining"`
+	CreditsResetAt   time.Time `json:"credits_reset_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// Counted since CreditsResetAt
+	Requests int `json:"requests"`
+	Credits  int `json:"credits"`
+	Deferred int `json:"deferred"`
+	Refused  int `json:"refused"`
+}
+
+type runCounts struct {
+	Requests int
+	Credits  int
+	Deferred int
+	Refused  int
+}
+
+// OpenCreditLedger loads the ledger saved at path, a missing file is a
+// fresh ledger. An empty path keeps the ledger in memory.
+func OpenCreditLedger(path string, reserve int) (*CreditLedger, error) {
+	l := &CreditLedger{Path: path, Reserve: reserve, Now: time.Now}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &l.state)
+	if err != nil {
+		return nil, fmt.Errorf("amazon: reading credit ledger %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *CreditLedger) now() time.Time {
+	if l.Now == nil {
+		return time.Now()
+	}
+	return l.Now()
+}
+
+// known reports whether the last counters we saw still apply, they stop
+// applying once the reset time passes. Must be called with mtx held.
+func (l *CreditLedger) known() bool {
+	if l.state.UpdatedAt.IsZero() {
+		return false
+	}
+	if !l.state.CreditsResetAt.IsZero() && !l.now().Before(l.state.CreditsResetAt) {
+		l.state = ledgerState{}
+		return false
+	}
+	return true
+}
+
+// Allow returns nil if a lookup may be sent. With no credits left at all
+// it returns ErrQuota, and with only the reserve left ErrBudgetReserve
+// for anything that is not essential.
+func (l *CreditLedger) Allow(essential bool) error {
+	return l.AllowN(1, essential)
+}
+
+// AllowN is Allow for n requests sent together, like a collection run.
+// Anything that is not essential has to leave the reserve untouched.
+func (l *CreditLedger) AllowN(n int, essential bool) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.known() {
+		return nil
+	}
+	switch {
+	case l.state.CreditsRemaining < n:
+		l.state.Refused++
+		l.run.Refused++
+		l.save()
+		return ErrQuota
+	case !essential && l.state.CreditsRemaining-n < l.Reserve:
+		l.state.Deferred++
+		l.run.Deferred++
+		l.save()
+		return ErrBudgetReserve
+	}
+	return nil
+}
+
+// Record updates the ledger from a response and saves it.
+func (l *CreditLedger) Record(info RequestInfo) error {
+	if info.CreditsResetAt.IsZero() && info.CreditsRemaining == 0 && info.CreditsUsed == 0 {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.known()
+	l.state.CreditsUsed = info.CreditsUsed
+	l.state.CreditsRemaining = info.CreditsRemaining
+	l.state.CreditsResetAt = info.CreditsResetAt
+	l.state.UpdatedAt = l.now()
+	l.state.Requests++
+	l.state.Credits += info.CreditsUsedThisRequest
+	l.run.Requests++
+	l.run.Credits += info.CreditsUsedThisRequest
+	return l.save()
+}
+
+func (l *CreditLedger) Save() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.save()
+}
+
+// save must be called with mtx held.
+func (l *CreditLedger) save() error {
+	if l.Path == "" {
+		return nil
+	}
+	return writeJSONAtomic(l.Path, l.state, true)
+}
+
+type BudgetReport struct {
+	Known            bool
+	CreditsUsed      int
+	CreditsRemaining int
+	CreditsResetAt   time.Time
+	Reserve          int
+	UpdatedAt        time.Time
+
+	// Since the last reset
+	Requests int
+	Credits  int
+	Deferred int
+	Refused  int
+
+	// Since the ledger was opened
+	RunRequests int
+	RunCredits  int
+	RunDeferred int
+	RunRefused  int
+}
+
+func (l *CreditLedger) Report() BudgetReport {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return BudgetReport{
+		Known:            l.known(),
+		CreditsUsed:      l.state.CreditsUsed,
+		CreditsRemaining: l.state.CreditsRemaining,
+		CreditsResetAt:   l.state.CreditsResetAt,
+		Reserve:          l.Reserve,
+		UpdatedAt:        l.state.UpdatedAt,
+		Requests:         l.state.Requests,
+		Credits:          l.state.Credits,
+		Deferred:         l.state.Deferred,
+		Refused:          l.state.Refused,
+		RunRequests:      l.run.Requests,
+		RunCredits:       l.run.Credits,
+		RunDeferred:      l.run.Deferred,
+		RunRefused:       l.run.Refused,
+	}
+}
+
+func (r BudgetReport) String() string {
+	sb := &strings.Builder{}
+	if r.Known {
+		fmt.Fprintf(sb, "Rainforest credits: %d used, %d remaining, %d reserved", r.CreditsUsed, r.CreditsRemaining, r.Reserve)
+		if !r.CreditsResetAt.IsZero() {
+			fmt.Fprintf(sb, ", resets %s", r.CreditsResetAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Fprintln(sb)
+	} else {
+		fmt.Fprintf(sb, "Rainforest credits: unknown until the next request, %d reserved\n", r.Reserve)
+	}
+	fmt.Fprintf(sb, "This period: %d requests, %d credits, %d deferred, %d refused\n", r.Requests, r.Credits, r.Deferred, r.Refused)
+	fmt.Fprintf(sb, "This run: %d requests, %d credits, %d deferred, %d refused\n", r.RunRequests, r.RunCredits, r.RunDeferred, r.RunRefused)
+	return sb.String()
+}
@@ -0,0 +1,30 @@
+package amazon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound     = errors.New("amazon: product not found")
+	ErrCacheCorrupt = errors.New("amazon: cache entry is corrupt")
+	ErrQuota        = errors.New("amazon: rainforest credits exhausted")
+	ErrNotCached    = errors.New("amazon: not in cache")
+	ErrNoFixture    = errors.New("amazon: no recorded response")
+	ErrCacheLocked  = errors.New("amazon: cache is already open")
+)
+
+// ErrHTTPStatus is returned when Rainforest answers with anything but a
+// 200. A 402 also matches ErrQuota with errors.Is.
+type ErrHTTPStatus struct {
+	Code int
+}
+
+func (e ErrHTTPStatus) Error() string {
+	return fmt.Sprintf("amazon: unexpected status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+func (e ErrHTTPStatus) Is(target error) bool {
+	return target == ErrQuota && e.Code == http.StatusPaymentRequired
+}
@@ -0,0 +1,407 @@
+package amazon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileCache is the original cache layout, one JSON file per id in Dir and
+// a missing.json listing the ids Rainforest did not know about.
+//
+// Files are replaced atomically, changes to missing.json hold an exclusive
+// lock on Dir and loading the index a shared one, so several processes can
+// share one FileCache. Unreadable files are moved into a quarantine
+// subdirectory, see Recover.
+type FileCache struct {
+	Dir string
+	// Codec compresses the files written, nil writes plain JSON. Files
+	// written with any of Codecs are read whatever this is set to.
+	Codec Codec
+	// Slim stores ProductData.Slim instead of the full response.
+	Slim bool
+
+	loadOnce sync.Once
+	mtx      sync.RWMutex
+	// index has nil for ids with a file and the entry for missing ids
+	index map[string]*MissingEntry
+}
+
+func NewFileCache(dir string) *FileCache {
+	return &FileCache{Dir: dir}
+}
+
+// Namespace returns a FileCache in a subdirectory of fc.Dir.
+func (fc *FileCache) Namespace(name string) ProductCache {
+	ns := NewFileCache(filepath.Join(fc.Dir, name))
+	ns.Codec = fc.Codec
+	ns.Slim = fc.Slim
+	return ns
+}
+
+func (fc *FileCache) file(id string) string {
+	return filepath.Join(fc.Dir, cacheFileName(id, fc.Codec))
+}
+
+// find returns the file id is stored in and its codec, trying fc.Codec
+// first, or "" if there is none.
+func (fc *FileCache) find(id string) (string, Codec) {
+	codecs := append([]Codec{fc.Codec, nil}, Codecs...)
+	for _, c := range codecs {
+		filename := filepath.Join(fc.Dir, cacheFileName(id, c))
+		if _, err := os.Stat(filename); err == nil {
+			return filename, c
+		}
+	}
+	return "", nil
+}
+
+// removeOthers removes the files for id written with other codecs.
+func (fc *FileCache) removeOthers(id string) {
+	for _, c := range append([]Codec{nil}, Codecs...) {
+		if c != fc.Codec {
+			os.Remove(filepath.Join(fc.Dir, cacheFileName(id, c)))
+		}
+	}
+}
+
+func (fc *FileCache) missingFile() string {
+	return filepath.Join(fc.Dir, "missing.json")
+}
+
+func (fc *FileCache) load() {
+	fc.loadOnce.Do(func() {
+		fc.mtx.Lock()
+		defer fc.mtx.Unlock()
+
+		fc.index = make(map[string]*MissingEntry)
+		lock, err := lockDir(fc.Dir, false)
+		if err != nil {
+			log.Println("Locking cache: ", err)
+		}
+		defer lock.Unlock()
+		files, _ := os.ReadDir(fc.Dir)
+		for _, file := range files {
+			name := file.Name()
+			if _, ok := codecFor(name); !ok || file.IsDir() || isTemp(name) {
+				continue
+			}
+			id := cacheFileID(name)
+			if id == "missing" {
+				continue
+			}
+			fc.index[id] = nil
+		}
+		entries, err := readMissing(fc.missingFile())
+		if errors.Is(err, ErrCacheCorrupt) {
+			quarantine(fc.missingFile())
+		}
+		for _, e := range entries {
+			e := e
+			fc.index[e.ID] = &e
+		}
+	})
+}
+
+// readMissing reads missing.json, which used to be a plain list of ids.
+// Those are given the file's modification time as when they were marked.
+// A missing.json that does not exist is an empty list.
+func readMissing(filename string) ([]MissingEntry, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []MissingEntry{}
+	if json.Unmarshal(data, &entries) == nil {
+		return entries, nil
+	}
+	ids := []string{}
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCacheCorrupt, filename, err)
+	}
+	entries = entries[:0]
+	marked := time.Now()
+	if st, err := os.Stat(filename); err == nil {
+		marked = st.ModTime()
+	}
+	for _, id := range ids {
+		entries = append(entries, MissingEntry{ID: id, Reason: MissNotFound, MarkedAt: marked})
+	}
+	return entries, nil
+}
+
+func (fc *FileCache) Get(id string) (ProductData, time.Time, error) {
+	fc.load()
+	fc.mtx.RLock()
+	missing, ok := fc.index[id]
+	fc.mtx.RUnlock()
+	if missing != nil {
+		return ProductData{}, missing.MarkedAt, MissingError{Entry: *missing}
+	}
+
+	// ids not in the index are looked for on disk too, another process
+	// or cache may have written them since it was loaded
+	filename, codec := fc.find(id)
+	if filename == "" {
+		return ProductData{}, time.Time{}, ErrNotCached
+	}
+	if !ok {
+		fc.mtx.Lock()
+		if _, ok := fc.index[id]; !ok {
+			fc.index[id] = nil
+		}
+		fc.mtx.Unlock()
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return ProductData{}, time.Time{}, ErrNotCached
+	}
+	if err != nil {
+		return ProductData{}, time.Time{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return ProductData{}, time.Time{}, err
+	}
+	pd, err := decodeProduct(f, codec)
+	if err != nil {
+		f.Close()
+		fc.mtx.Lock()
+		if quarantine(filename) == nil {
+			delete(fc.index, id)
+		}
+		fc.mtx.Unlock()
+		return ProductData{}, st.ModTime(), fmt.Errorf("%w: %s: %v", ErrCacheCorrupt, id, err)
+	}
+	return pd, st.ModTime(), nil
+}
+
+func (fc *FileCache) Put(id string, pd ProductData) error {
+	fc.load()
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+
+	if fc.Slim {
+		pd = pd.Slim()
+	}
+	err := writeFileAtomic(fc.file(id), func(w io.Writer) error {
+		return encodeProduct(w, fc.Codec, pd)
+	})
+	if err != nil {
+		return fmt.Errorf("amazon: caching %s: %w", id, err)
+	}
+	fc.removeOthers(id)
+
+	wasMissing := fc.index[id] != nil
+	fc.index[id] = nil
+	if wasMissing {
+		return fc.updateMissing(func(missing map[string]MissingEntry) {
+			delete(missing, id)
+		})
+	}
+	return nil
+}
+
+func (fc *FileCache) MarkMissing(entry MissingEntry) error {
+	fc.load()
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	return fc.updateMissing(func(missing map[string]MissingEntry) {
+		missing[entry.ID] = entry
+	})
+}
+
+// Unmark takes id off the missing list, leaving any file for it alone.
+func (fc *FileCache) Unmark(id string) error {
+	fc.load()
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	if missing, ok := fc.index[id]; ok && missing == nil {
+		return nil
+	}
+	return fc.updateMissing(func(missing map[string]MissingEntry) {
+		delete(missing, id)
+	})
+}
+
+// markAll adds entries to the missing list in one write.
+func (fc *FileCache) markAll(entries []MissingEntry) error {
+	fc.load()
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	return fc.updateMissing(func(missing map[string]MissingEntry) {
+		for _, e := range entries {
+			missing[e.ID] = e
+		}
+	})
+}
+
+func (fc *FileCache) Forget(id string) error {
+	fc.load()
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	missing, ok := fc.index[id]
+	if !ok {
+		return nil
+	}
+	delete(fc.index, id)
+	if missing != nil {
+		return fc.updateMissing(func(missing map[string]MissingEntry) {
+			delete(missing, id)
+		})
+	}
+	for filename, _ := fc.find(id); filename != ""; filename, _ = fc.find(id) {
+		err := os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateMissing applies change to missing.json as it is on disk, holding
+// the lock on Dir so changes from other processes are kept, then brings
+// the index in line with the result. It must be called with mtx held.
+func (fc *FileCache) updateMissing(change func(map[string]MissingEntry)) error {
+	lock, err := lockDir(fc.Dir, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	entries, err := readMissing(fc.missingFile())
+	if errors.Is(err, ErrCacheCorrupt) {
+		err = quarantine(fc.missingFile())
+	}
+	if err != nil {
+		return err
+	}
+	missing := map[string]MissingEntry{}
+	for _, e := range entries {
+		missing[e.ID] = e
+	}
+	change(missing)
+
+	entries = make([]MissingEntry, 0, len(missing))
+	for _, e := range missing {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	err = writeJSONAtomic(fc.missingFile(), entries, false)
+	if err != nil {
+		return err
+	}
+
+	for id, m := range fc.index {
+		if _, ok := missing[id]; m != nil && !ok {
+			delete(fc.index, id)
+		}
+	}
+	for id, e := range missing {
+		e := e
+		fc.index[id] = &e
+	}
+	return nil
+}
+
+// Recover checks every file in Dir and its subdirectories, moving the ones
+// that cannot be decoded into quarantine and removing temp files left by
+// writes that never finished. It reads the whole cache, so it belongs at
+// startup rather than on every load. The quarantined files are returned.
+func (fc *FileCache) Recover() ([]string, error) {
+	lock, err := lockDir(fc.Dir, true)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	bad := []string{}
+	err = filepath.WalkDir(fc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if d.Name() == quarantineName {
+				return filepath.SkipDir
+			}
+			return nil
+		case isTemp(path):
+			// another process may still be writing a fresh one
+			if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if _, ok := codecFor(d.Name()); !ok {
+			return nil
+		}
+
+		if d.Name() == "missing.json" {
+			_, err = readMissing(path)
+		} else {
+			_, err = readProductFile(path)
+		}
+		if err == nil {
+			return nil
+		}
+		bad = append(bad, path)
+		return quarantine(path)
+	})
+	if err != nil {
+		return bad, err
+	}
+
+	fc.mtx.Lock()
+	defer fc.mtx.Unlock()
+	for _, path := range bad {
+		if filepath.Dir(path) != filepath.Clean(fc.Dir) {
+			continue
+		}
+		id := cacheFileID(path)
+		if id != "missing" {
+			delete(fc.index, id)
+			continue
+		}
+		for id, m := range fc.index {
+			if m != nil {
+				delete(fc.index, id)
+			}
+		}
+	}
+	return bad, nil
+}
+
+func (fc *FileCache) List() ([]CacheEntry, error) {
+	fc.load()
+	fc.mtx.RLock()
+	defer fc.mtx.RUnlock()
+	entries := make([]CacheEntry, 0, len(fc.index))
+	for id, missing := range fc.index {
+		e := CacheEntry{ID: id, Missing: missing}
+		if missing != nil {
+			e.Updated = missing.MarkedAt
+		} else if filename, _ := fc.find(id); filename != "" {
+			if st, err := os.Stat(filename); err == nil {
+				e.Updated = st.ModTime()
+			}
+		}
+		entries = append(entries, e)
+	}
+	return sortEntries(entries), nil
+}
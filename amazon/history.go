@@ -0,0 +1,175 @@
+package amazon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PricePoint is one observation of a product's buybox.
+type PricePoint struct {
+	Time            time.Time      `json:"time"`
+	ASIN            string         `json:"asin"`
+	Marketplace     string         `json:"marketplace"`
+	Price           float64        `json:"price"`
+	Currency        string         `json:"currency"`
+	Availability    string         `json:"availability"`
+	BestsellersRank map[string]int `json:"bestsellers_rank,omitempty"`
+}
+
+func NewPricePoint(pd ProductData, at time.Time) PricePoint {
+	p := NewProduct(pd)
+	pp := PricePoint{
+		Time:         at,
+		ASIN:         p.ASIN,
+		Marketplace:  p.Marketplace,
+		Price:        p.Price.Value,
+		Currency:     p.Price.Currency,
+		Availability: p.Availability,
+	}
+	if len(p.Ranks) > 0 {
+		pp.BestsellersRank = map[string]int{}
+		for _, r := range p.Ranks {
+			pp.BestsellersRank[r.Category] = r.Rank
+		}
+	}
+	return pp
+}
+
+// PriceHistory is an append only log of PricePoints, one file of JSON
+// lines per ASIN in Dir.
+type PriceHistory struct {
+	Dir string
+
+	mtx sync.Mutex
+}
+
+func NewPriceHistory(dir string) *PriceHistory {
+	return &PriceHistory{Dir: dir}
+}
+
+func (ph *PriceHistory) file(asin string) string {
+	return filepath.Join(ph.Dir, asin+".jsonl")
+}
+
+func (ph *PriceHistory) Record(pd ProductData, at time.Time) error {
+	if pd.Product.Asin == "" {
+		return nil
+	}
+	return ph.Append(NewPricePoint(pd, at))
+}
+
+func (ph *PriceHistory) Append(pp PricePoint) error {
+	line, err := json.Marshal(pp)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	ph.mtx.Lock()
+	defer ph.mtx.Unlock()
+	err = os.MkdirAll(ph.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ph.file(pp.ASIN), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Points returns every point recorded for asin in the marketplace, oldest
+// first. An empty marketplace returns all of them.
+func (ph *PriceHistory) Points(asin, marketplace string) ([]PricePoint, error) {
+	f, err := os.Open(ph.file(asin))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	points := []PricePoint{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var pp PricePoint
+		if json.Unmarshal(sc.Bytes(), &pp) != nil {
+			continue
+		}
+		if marketplace == "" || pp.Marketplace == marketplace {
+			points = append(points, pp)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("amazon: reading history for %s: %w", asin, err)
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+	return points, nil
+}
+
+type PriceStats struct {
+	Points   int
+	Currency string
+	Current  float64
+	Min      float64
+	MinAt    time.Time
+	Max      float64
+	MaxAt    time.Time
+	// Trend is the least squares slope of the price, per day.
+	Trend float64
+}
+
+// Stats summarizes the prices seen for asin in the marketplace over the
+// window ending at now. Points without a price, when it was unavailable,
+// are skipped.
+func (ph *PriceHistory) Stats(asin, marketplace string, window time.Duration, now time.Time) (PriceStats, error) {
+	points, err := ph.Points(asin, marketplace)
+	if err != nil {
+		return PriceStats{}, err
+	}
+	return PriceStatsFor(points, now.Add(-window)), nil
+}
+
+func PriceStatsFor(points []PricePoint, since time.Time) PriceStats {
+	ps := PriceStats{}
+	var sx, sy, sxx, sxy float64
+	for _, pp := range points {
+		if pp.Time.Before(since) || pp.Price <= 0 {
+			continue
+		}
+		if ps.Points == 0 || pp.Price < ps.Min {
+			ps.Min, ps.MinAt = pp.Price, pp.Time
+		}
+		if ps.Points == 0 || pp.Price > ps.Max {
+			ps.Max, ps.MaxAt = pp.Price, pp.Time
+		}
+		ps.Current = pp.Price
+		ps.Currency = pp.Currency
+		ps.Points++
+
+		x := pp.Time.Sub(since).Hours() / 24
+		sx += x
+		sy += pp.Price
+		sxx += x * x
+		sxy += x * pp.Price
+	}
+	n := float64(ps.Points)
+	if d := n*sxx - sx*sx; ps.Points > 1 && d != 0 {
+		ps.Trend = (n*sxy - sx*sy) / d
+	}
+	return ps
+}
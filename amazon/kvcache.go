@@ -0,0 +1,310 @@
+package amazon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// KVCache keeps the whole cache in a single append only file. Every Put,
+// MarkMissing and Forget appends one line, so marking an id missing costs
+// a few bytes instead of rewriting the full missing list. Superseded
+// lines are dropped by Compact.
+type KVCache struct {
+	Path string
+	// CompactRatio triggers a Compact from Put once the file holds this
+	// many times more bytes than the live entries need, 0 disables it.
+	CompactRatio float64
+	Now          func() time.Time
+
+	mtx   sync.RWMutex
+	lock  *os.File
+	f     *os.File
+	size  int64
+	live  int64
+	index map[string]kvEntry
+}
+
+type kvEntry struct {
+	offset  int64
+	length  int64
+	missing *MissingEntry
+	updated time.Time
+}
+
+type kvRecord struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id"`
+	Updated time.Time       `json:"updated"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Missing *MissingEntry   `json:"missing,omitempty"`
+}
+
+const (
+	kvPut     = "put"
+	kvMissing = "missing"
+	kvForget  = "forget"
+)
+
+// OpenKVCache opens or creates the store at path. A partially written
+// final line, from a crash mid write, is truncated away. Complete lines
+// that cannot be decoded are skipped and copied into the quarantine
+// directory next to the store, the rest of the file is still read.
+//
+// The store can only be open once at a time, it is locked through a .lock
+// file next to it until Close and opening it again returns ErrCacheLocked.
+func OpenKVCache(path string) (*KVCache, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = tryLockFile(lock)
+	if err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("amazon: opening %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err == nil {
+		kv := &KVCache{
+			Path:         path,
+			CompactRatio: 4,
+			Now:          time.Now,
+			lock:         lock,
+			f:            f,
+			index:        map[string]kvEntry{},
+		}
+		err = kv.scan()
+		if err == nil {
+			return kv, nil
+		}
+		f.Close()
+	}
+	untryLockFile(lock)
+	lock.Close()
+	return nil, err
+}
+
+func (kv *KVCache) scan() error {
+	r := bufio.NewReader(kv.f)
+	var offset int64
+	var corrupt [][]byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var rec kvRecord
+		if json.Unmarshal(line, &rec) != nil {
+			corrupt = append(corrupt, line)
+		} else {
+			kv.apply(rec, offset, int64(len(line)))
+		}
+		offset += int64(len(line))
+	}
+	if len(corrupt) > 0 {
+		err := quarantineLines(kv.Path, corrupt)
+		if err != nil {
+			return fmt.Errorf("amazon: %d corrupt records in %s: %w", len(corrupt), kv.Path, err)
+		}
+	}
+	kv.size = offset
+	err := kv.f.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	_, err = kv.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// apply must be called with mtx held.
+func (kv *KVCache) apply(rec kvRecord, offset, length int64) {
+	if old, ok := kv.index[rec.ID]; ok {
+		kv.live -= old.length
+	}
+	switch rec.Op {
+	case kvForget:
+		delete(kv.index, rec.ID)
+		return
+	case kvMissing:
+		missing := rec.Missing
+		if missing == nil {
+			missing = &MissingEntry{ID: rec.ID, Reason: MissNotFound, MarkedAt: rec.Updated}
+		}
+		kv.index[rec.ID] = kvEntry{offset: offset, length: length, missing: missing, updated: rec.Updated}
+	default:
+		kv.index[rec.ID] = kvEntry{offset: offset, length: length, updated: rec.Updated}
+	}
+	kv.live += length
+}
+
+func (kv *KVCache) now() time.Time {
+	if kv.Now == nil {
+		return time.Now()
+	}
+	return kv.Now()
+}
+
+func (kv *KVCache) Get(id string) (ProductData, time.Time, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	e, ok := kv.index[id]
+	switch {
+	case !ok:
+		return ProductData{}, time.Time{}, ErrNotCached
+	case e.missing != nil:
+		return ProductData{}, e.updated, MissingError{Entry: *e.missing}
+	}
+
+	buf := make([]byte, e.length)
+	_, err := kv.f.ReadAt(buf, e.offset)
+	if err != nil {
+		return ProductData{}, e.updated, err
+	}
+	var rec kvRecord
+	err = json.Unmarshal(buf, &rec)
+	if err == nil {
+		var pd ProductData
+		err = json.Unmarshal(rec.Data, &pd)
+		if err == nil {
+			return pd, e.updated, nil
+		}
+	}
+	return ProductData{}, e.updated, fmt.Errorf("%w: %s: %v", ErrCacheCorrupt, id, err)
+}
+
+func (kv *KVCache) Put(id string, pd ProductData) error {
+	data, err := json.Marshal(pd)
+	if err != nil {
+		return fmt.Errorf("amazon: caching %s: %w", id, err)
+	}
+	err = kv.append(kvRecord{Op: kvPut, ID: id, Data: data})
+	if err != nil {
+		return err
+	}
+	if kv.needsCompact() {
+		return kv.Compact()
+	}
+	return nil
+}
+
+func (kv *KVCache) MarkMissing(entry MissingEntry) error {
+	return kv.append(kvRecord{Op: kvMissing, ID: entry.ID, Missing: &entry})
+}
+
+func (kv *KVCache) Unmark(id string) error {
+	kv.mtx.RLock()
+	e, ok := kv.index[id]
+	kv.mtx.RUnlock()
+	if !ok || e.missing == nil {
+		return nil
+	}
+	return kv.append(kvRecord{Op: kvForget, ID: id})
+}
+
+func (kv *KVCache) Forget(id string) error {
+	kv.mtx.RLock()
+	_, ok := kv.index[id]
+	kv.mtx.RUnlock()
+	if !ok {
+		return nil
+	}
+	return kv.append(kvRecord{Op: kvForget, ID: id})
+}
+
+func (kv *KVCache) append(rec kvRecord) error {
+	rec.Updated = kv.now()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	_, err = kv.f.WriteAt(line, kv.size)
+	if err != nil {
+		return fmt.Errorf("amazon: writing %s: %w", kv.Path, err)
+	}
+	kv.apply(rec, kv.size, int64(len(line)))
+	kv.size += int64(len(line))
+	return nil
+}
+
+func (kv *KVCache) needsCompact() bool {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	return kv.CompactRatio > 0 && kv.size > 1<<20 && float64(kv.size) > kv.CompactRatio*float64(kv.live)
+}
+
+// Compact rewrites the store with only the latest line for each id.
+func (kv *KVCache) Compact() error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+
+	index := make(map[string]kvEntry, len(kv.index))
+	var offset int64
+	err := writeFileAtomic(kv.Path, func(out io.Writer) error {
+		w := bufio.NewWriter(out)
+		for id, e := range kv.index {
+			buf := make([]byte, e.length)
+			_, err := kv.f.ReadAt(buf, e.offset)
+			if err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(buf, []byte("\n")) {
+				return fmt.Errorf("amazon: bad record for %s in %s", id, kv.Path)
+			}
+			_, err = w.Write(buf)
+			if err != nil {
+				return err
+			}
+			e.offset = offset
+			index[id] = e
+			offset += e.length
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(kv.Path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	kv.f.Close()
+	kv.f = f
+	kv.index = index
+	kv.size = offset
+	kv.live = offset
+	return nil
+}
+
+func (kv *KVCache) List() ([]CacheEntry, error) {
+	kv.mtx.RLock()
+	defer kv.mtx.RUnlock()
+	entries := make([]CacheEntry, 0, len(kv.index))
+	for id, e := range kv.index {
+		entries = append(entries, CacheEntry{ID: id, Missing: e.missing, Updated: e.updated})
+	}
+	return sortEntries(entries), nil
+}
+
+func (kv *KVCache) Close() error {
+	kv.mtx.Lock()
+	defer kv.mtx.Unlock()
+	err := kv.f.Close()
+	untryLockFile(kv.lock)
+	if lerr := kv.lock.Close(); err == nil {
+		err = lerr
+	}
+	return err
+}
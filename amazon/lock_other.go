@@ -0,0 +1,43 @@
+//go:build !unix
+
+package amazon
+
+import (
+	"os"
+	"sync"
+)
+
+// Without flock the lock only covers this process, and shared locks are
+// taken exclusively.
+var (
+	processLock sync.Mutex
+	triedMtx    sync.Mutex
+	tried       = map[string]bool{}
+)
+
+func lockFile(f *os.File, exclusive bool) error {
+	processLock.Lock()
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	processLock.Unlock()
+	return nil
+}
+
+func tryLockFile(f *os.File) error {
+	triedMtx.Lock()
+	defer triedMtx.Unlock()
+	if tried[f.Name()] {
+		return ErrCacheLocked
+	}
+	tried[f.Name()] = true
+	return nil
+}
+
+func untryLockFile(f *os.File) error {
+	triedMtx.Lock()
+	delete(tried, f.Name())
+	triedMtx.Unlock()
+	return nil
+}
@@ -0,0 +1,138 @@
+package amazon
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Marketplace is one of the Amazon storefronts Rainforest can query. Vendor
+// matches the vendor name data.NewPurchaseLink gives the storefront's links.
+type Marketplace struct {
+	Domain   string
+	Vendor   string
+	Currency string
+}
+
+var (
+	MarketplaceUS      = Marketplace{Domain: "amazon.com", Vendor: "Amazon US", Currency: "USD"}
+	MarketplaceCanada  = Marketplace{Domain: "amazon.ca", Vendor: "Amazon Canada", Currency: "CAD"}
+	MarketplaceUK      = Marketplace{Domain: "amazon.co.uk", Vendor: "Amazon UK", Currency: "GBP"}
+	MarketplaceGermany = Marketplace{Domain: "amazon.de", Vendor: "Amazon Germany", Currency: "EUR"}
+	MarketplaceJapan   = Marketplace{Domain: "amazon.co.jp", Vendor: "Amazon Japan", Currency: "JPY"}
+
+	Marketplaces = []Marketplace{
+		MarketplaceUS,
+		MarketplaceCanada,
+		MarketplaceUK,
+		MarketplaceGermany,
+		MarketplaceJapan,
+	}
+)
+
+func MarketplaceByDomain(domain string) (Marketplace, bool) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	for _, m := range Marketplaces {
+		if m.Domain == domain {
+			return m, true
+		}
+	}
+	return Marketplace{}, false
+}
+
+func MarketplaceByVendor(vendor string) (Marketplace, bool) {
+	for _, m := range Marketplaces {
+		if m.Vendor == vendor {
+			return m, true
+		}
+	}
+	return Marketplace{}, false
+}
+
+func (m Marketplace) ProductLink(asin string) string {
+	return "https://www." + m.Domain + "/dp/" + asin
+}
+
+func (c *Client) marketplace() Marketplace {
+	if c.Marketplace.Domain == "" {
+		return MarketplaceUS
+	}
+	return c.Marketplace
+}
+
+// In returns a client for another marketplace. It shares the API key and
+// HTTP client with c, but keeps its products in their own namespace of
+// c's cache, since the same ASIN can be a different book elsewhere. The
+// US marketplace uses c's cache as is.
+func (c *Client) In(m Marketplace) *Client {
+	mc := *c
+	mc.Marketplace = m
+	if m.Domain != MarketplaceUS.Domain {
+		mc.Cache = NamespacedCache(c.Cache, m.Domain)
+	}
+	return &mc
+}
+
+// NamespacedCache returns a view of cache that only sees ids stored under
+// namespace. Caches with their own idea of namespaces, like FileCache using
+// subdirectories, provide a Namespace method that is used instead.
+func NamespacedCache(cache ProductCache, namespace string) ProductCache {
+	if ns, ok := cache.(interface {
+		Namespace(string) ProductCache
+	}); ok {
+		return ns.Namespace(namespace)
+	}
+	return prefixCache{prefix: namespace + "/", cache: cache}
+}
+
+type prefixCache struct {
+	prefix string
+	cache  ProductCache
+}
+
+func (pc prefixCache) Get(id string) (ProductData, time.Time, error) {
+	pd, updated, err := pc.cache.Get(pc.prefix + id)
+	var missing MissingError
+	if errors.As(err, &missing) {
+		missing.Entry.ID = id
+		err = missing
+	}
+	return pd, updated, err
+}
+
+func (pc prefixCache) Put(id string, pd ProductData) error {
+	return pc.cache.Put(pc.prefix+id, pd)
+}
+
+func (pc prefixCache) MarkMissing(entry MissingEntry) error {
+	entry.ID = pc.prefix + entry.ID
+	return pc.cache.MarkMissing(entry)
+}
+
+func (pc prefixCache) Unmark(id string) error {
+	return pc.cache.Unmark(pc.prefix + id)
+}
+
+func (pc prefixCache) Forget(id string) error {
+	return pc.cache.Forget(pc.prefix + id)
+}
+
+func (pc prefixCache) List() ([]CacheEntry, error) {
+	all, err := pc.cache.List()
+	if err != nil {
+		return nil, err
+	}
+	entries := []CacheEntry{}
+	for _, e := range all {
+		if strings.HasPrefix(e.ID, pc.prefix) {
+			e.ID = strings.TrimPrefix(e.ID, pc.prefix)
+			if e.Missing != nil {
+				m := *e.Missing
+				m.ID = e.ID
+				e.Missing = &m
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,202 @@
+package amazon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MissReason string
+
+const (
+	MissNotFound MissReason = "not_found"
+	MissAPIError MissReason = "api_error"
+	MissBadGTIN  MissReason = "bad_gtin"
+)
+
+// MissingEntry records why an id is on the missing list. A zero ExpiresAt
+// comes from an old missing.json and expires by the client's policy.
+type MissingEntry struct {
+	ID        string     `json:"id"`
+	Reason    MissReason `json:"reason"`
+	Detail    string     `json:"detail,omitempty"`
+	MarkedAt  time.Time  `json:"marked_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// MissingError is what a cache returns for an id on the missing list, it
+// matches ErrNotFound with errors.Is.
+type MissingError struct {
+	Entry MissingEntry
+}
+
+func (e MissingError) Error() string {
+	msg := fmt.Sprintf("amazon: %s is missing (%s", e.Entry.ID, e.Entry.Reason)
+	if e.Entry.Detail != "" {
+		msg += ": " + e.Entry.Detail
+	}
+	return msg + ")"
+}
+
+func (e MissingError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// MissingPolicy decides how long an id stays on the missing list. Ids
+// hinted to release within NearReleaseWindow, before or after, use
+// NearReleaseTTL since that is when preorders show up on Amazon.
+type MissingPolicy struct {
+	TTL               time.Duration
+	ErrorTTL          time.Duration
+	NearReleaseTTL    time.Duration
+	NearReleaseWindow time.Duration
+}
+
+var DefaultMissingPolicy = MissingPolicy{
+	TTL:               30 * 24 * time.Hour,
+	ErrorTTL:          24 * time.Hour,
+	NearReleaseTTL:    2 * 24 * time.Hour,
+	NearReleaseWindow: 45 * 24 * time.Hour,
+}
+
+func (mp MissingPolicy) ttl(reason MissReason, release, now time.Time) time.Duration {
+	ttl := mp.TTL
+	if reason == MissAPIError && mp.ErrorTTL > 0 {
+		ttl = mp.ErrorTTL
+	}
+	if !release.IsZero() && mp.NearReleaseTTL > 0 && mp.NearReleaseTTL < ttl {
+		d := release.Sub(now)
+		if d < 0 {
+			d = -d
+		}
+		if d <= mp.NearReleaseWindow {
+			ttl = mp.NearReleaseTTL
+		}
+	}
+	return ttl
+}
+
+type releaseHints struct {
+	mtx   sync.RWMutex
+	dates map[string]time.Time
+}
+
+// HintRelease tells the client when the book behind id is released, which
+// shortens how long it stays missing around that date.
+func (c *Client) HintRelease(id string, release time.Time) {
+	if c.hints == nil {
+		return
+	}
+	c.hints.mtx.Lock()
+	if c.hints.dates == nil {
+		c.hints.dates = map[string]time.Time{}
+	}
+	c.hints.dates[CleanGTIN(id)] = release
+	c.hints.mtx.Unlock()
+}
+
+func (c *Client) release(id string) time.Time {
+	if c.hints == nil {
+		return time.Time{}
+	}
+	c.hints.mtx.RLock()
+	defer c.hints.mtx.RUnlock()
+	return c.hints.dates[id]
+}
+
+// MarkMissing puts id on the missing list until the policy says to try
+// again.
+func (c *Client) MarkMissing(id string, reason MissReason, detail string) error {
+	now := c.now()
+	return c.Cache.MarkMissing(MissingEntry{
+		ID:        id,
+		Reason:    reason,
+		Detail:    detail,
+		MarkedAt:  now,
+		ExpiresAt: now.Add(c.MissingPolicy.ttl(reason, c.release(id), now)),
+	})
+}
+
+func (c *Client) expired(e MissingEntry) bool {
+	expires := e.ExpiresAt
+	if expires.IsZero() {
+		expires = e.MarkedAt.Add(c.MissingPolicy.ttl(e.Reason, c.release(e.ID), e.MarkedAt))
+	}
+	return !c.now().Before(expires)
+}
+
+// MissingReport lists the ids currently on the missing list, most
+// recently marked first.
+func (c *Client) MissingReport() ([]MissingEntry, error) {
+	entries, err := c.Cache.List()
+	if err != nil {
+		return nil, err
+	}
+	report := []MissingEntry{}
+	for _, e := range entries {
+		if e.Missing == nil || c.expired(*e.Missing) {
+			continue
+		}
+		m := *e.Missing
+		if m.ExpiresAt.IsZero() {
+			m.ExpiresAt = m.MarkedAt.Add(c.MissingPolicy.ttl(m.Reason, c.release(m.ID), m.MarkedAt))
+		}
+		report = append(report, m)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].MarkedAt.After(report[j].MarkedAt)
+	})
+	return report, nil
+}
+
+func FormatMissingReport(entries []MissingEntry) string {
+	sb := &strings.Builder{}
+	for _, e := range entries {
+		fmt.Fprintf(sb, "%-14s %-10s marked %s, retry after %s", e.ID, e.Reason, e.MarkedAt.Format("2006-01-02"), e.ExpiresAt.Format("2006-01-02"))
+		if e.Detail != "" {
+			fmt.Fprintf(sb, " (%s)", e.Detail)
+		}
+		fmt.Fprintln(sb)
+	}
+	return sb.String()
+}
+
+// ValidGTIN checks the check digit of an ISBN-10 or a GTIN-8, 12, 13 or
+// 14, after removing dashes and spaces.
+func ValidGTIN(id string) bool {
+	id = strings.ToUpper(strings.ReplaceAll(CleanGTIN(id), " ", ""))
+	switch len(id) {
+	case 10:
+		sum := 0
+		for i, r := range id {
+			var d int
+			switch {
+			case r >= '0' && r <= '9':
+				d = int(r - '0')
+			case r == 'X' && i == 9:
+				d = 10
+			default:
+				return false
+			}
+			sum += d * (10 - i)
+		}
+		return sum%11 == 0
+	case 8, 12, 13, 14:
+		sum := 0
+		for i, r := range id {
+			if r < '0' || r > '9' {
+				return false
+			}
+			d := int(r - '0')
+			// weights alternate 3,1 counting from the digit before the check digit
+			if (len(id)-1-i)%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return sum%10 == 0
+	}
+	return false
+}
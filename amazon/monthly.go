@@ -0,0 +1,327 @@
+package amazon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const monthLayout = "2006-01"
+
+// MonthlyCache is the shared cache layout, Root/YYYY-MM/ holds a FileCache
+// for each month. Writes always go to the current month, so each month
+// directory is a snapshot of what was fetched during it, and reads fall
+// back through older months so a new month starts with last month's data.
+// The missing list is the exception, only the newest month's is read and a
+// new month starts with a copy of the one before, so it can be changed
+// without touching older snapshots. Other marketplaces live in a
+// subdirectory of each month named for their domain.
+//
+// When Retention is set, months older than that many months are moved into
+// ArchiveDir, or deleted when it is empty, as the month rolls over. Legacy
+// is an old single directory cache, like amazon/current, that is read when
+// no month has an id. Use NewMonthlyCache, the zero value is not usable.
+type MonthlyCache struct {
+	Root       string
+	Retention  int
+	ArchiveDir string
+	Legacy     string
+	// Codec and Slim are passed on to each month's FileCache.
+	Codec Codec
+	Slim  bool
+	Now   func() time.Time
+
+	sub    string
+	shared *monthlyShared
+}
+
+type monthlyShared struct {
+	mtx     sync.Mutex
+	caches  map[string]*FileCache
+	rotated string
+	seeded  map[string]bool
+}
+
+func NewMonthlyCache(root string) *MonthlyCache {
+	return &MonthlyCache{Root: root, Now: time.Now, shared: &monthlyShared{}}
+}
+
+func (mc *MonthlyCache) now() time.Time {
+	if mc.Now == nil {
+		return time.Now()
+	}
+	return mc.Now()
+}
+
+// Sub returns the cache for a marketplace, or any other namespace, sharing
+// this cache's months.
+func (mc *MonthlyCache) Sub(name string) *MonthlyCache {
+	sub := *mc
+	sub.sub = filepath.Join(mc.sub, name)
+	if sub.Legacy != "" {
+		sub.Legacy = filepath.Join(mc.Legacy, name)
+	}
+	return &sub
+}
+
+func (mc *MonthlyCache) Namespace(name string) ProductCache {
+	return mc.Sub(name)
+}
+
+// Dir is the directory holding the snapshot for the month of t.
+func (mc *MonthlyCache) Dir(t time.Time) string {
+	return filepath.Join(mc.Root, t.Format(monthLayout), mc.sub)
+}
+
+func (mc *MonthlyCache) fileCache(dir string) *FileCache {
+	mc.shared.mtx.Lock()
+	defer mc.shared.mtx.Unlock()
+	if mc.shared.caches == nil {
+		mc.shared.caches = map[string]*FileCache{}
+	}
+	fc, ok := mc.shared.caches[dir]
+	if !ok {
+		fc = NewFileCache(dir)
+		fc.Codec = mc.Codec
+		fc.Slim = mc.Slim
+		mc.shared.caches[dir] = fc
+	}
+	return fc
+}
+
+// current returns the cache for this month, rotating when the month has
+// changed since the last write and starting the month's missing list from
+// the previous snapshot's.
+func (mc *MonthlyCache) current() (*FileCache, error) {
+	now := mc.now()
+	month := now.Format(monthLayout)
+	dir := mc.Dir(now)
+	mc.shared.mtx.Lock()
+	rotate := mc.shared.rotated != month
+	mc.shared.rotated = month
+	if mc.shared.seeded == nil {
+		mc.shared.seeded = map[string]bool{}
+	}
+	seed := !mc.shared.seeded[dir]
+	mc.shared.seeded[dir] = true
+	mc.shared.mtx.Unlock()
+
+	var missing []MissingEntry
+	if _, err := os.Stat(dir); seed && os.IsNotExist(err) {
+		missing, err = mc.missing(now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rotate {
+		mc.Rotate(now)
+	}
+	fc := mc.fileCache(dir)
+	if len(missing) > 0 {
+		return fc, fc.markAll(missing)
+	}
+	return fc, nil
+}
+
+// missing is the missing list of the newest snapshot at t.
+func (mc *MonthlyCache) missing(t time.Time) ([]MissingEntry, error) {
+	snapshots := mc.snapshots(t)
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	entries, err := snapshots[0].List()
+	if err != nil {
+		return nil, err
+	}
+	missing := []MissingEntry{}
+	for _, e := range entries {
+		if e.Missing != nil {
+			missing = append(missing, *e.Missing)
+		}
+	}
+	return missing, nil
+}
+
+// Months lists the snapshot months on disk, newest first.
+func (mc *MonthlyCache) Months() []string {
+	matches, _ := filepath.Glob(filepath.Join(mc.Root, "[0-9][0-9][0-9][0-9]-[0-9][0-9]"))
+	months := []string{}
+	for _, m := range matches {
+		month := filepath.Base(m)
+		if _, err := time.Parse(monthLayout, month); err == nil {
+			months = append(months, month)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(months)))
+	return months
+}
+
+// snapshots are the caches to read for a lookup at t, newest first. Months
+// are only listed once this cache's subdirectory exists in them, another
+// marketplace starting a month does not start it here.
+func (mc *MonthlyCache) snapshots(t time.Time) []*FileCache {
+	limit := t.Format(monthLayout)
+	caches := []*FileCache{}
+	for _, month := range mc.Months() {
+		if month > limit {
+			continue
+		}
+		dir := filepath.Join(mc.Root, month, mc.sub)
+		if _, err := os.Stat(dir); mc.sub != "" && err != nil {
+			continue
+		}
+		caches = append(caches, mc.fileCache(dir))
+	}
+	if mc.Legacy != "" {
+		caches = append(caches, mc.fileCache(mc.Legacy))
+	}
+	return caches
+}
+
+func (mc *MonthlyCache) Get(id string) (ProductData, time.Time, error) {
+	for i, fc := range mc.snapshots(mc.now()) {
+		pd, updated, err := fc.Get(id)
+		var missing MissingError
+		if errors.Is(err, ErrNotCached) || i > 0 && errors.As(err, &missing) {
+			continue
+		}
+		return pd, updated, err
+	}
+	return ProductData{}, time.Time{}, ErrNotCached
+}
+
+// LoadAt returns the freshest snapshot of id stored at or before t.
+func (mc *MonthlyCache) LoadAt(id string, t time.Time) (ProductData, time.Time, error) {
+	for _, fc := range mc.snapshots(t) {
+		pd, updated, err := fc.Get(id)
+		if errors.Is(err, ErrNotCached) || updated.After(t) {
+			continue
+		}
+		return pd, updated, err
+	}
+	return ProductData{}, time.Time{}, ErrNotCached
+}
+
+func (mc *MonthlyCache) Put(id string, pd ProductData) error {
+	fc, err := mc.current()
+	if err != nil {
+		return err
+	}
+	return fc.Put(id, pd)
+}
+
+func (mc *MonthlyCache) MarkMissing(entry MissingEntry) error {
+	fc, err := mc.current()
+	if err != nil {
+		return err
+	}
+	return fc.MarkMissing(entry)
+}
+
+// Unmark takes id off this month's missing list, older snapshots are left
+// as they were.
+func (mc *MonthlyCache) Unmark(id string) error {
+	fc, err := mc.current()
+	if err != nil {
+		return err
+	}
+	return fc.Unmark(id)
+}
+
+// Forget removes id from every snapshot, otherwise an older month would
+// answer for it instead.
+func (mc *MonthlyCache) Forget(id string) error {
+	var err error
+	for _, fc := range mc.snapshots(mc.now()) {
+		if ferr := fc.Forget(id); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// List merges the snapshots, each id listed from the newest month it is in,
+// with missing entries only from the newest.
+func (mc *MonthlyCache) List() ([]CacheEntry, error) {
+	seen := map[string]bool{}
+	entries := []CacheEntry{}
+	for i, fc := range mc.snapshots(mc.now()) {
+		list, err := fc.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range list {
+			if !seen[e.ID] && (i == 0 || e.Missing == nil) {
+				seen[e.ID] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	return sortEntries(entries), nil
+}
+
+// Recover runs FileCache.Recover over every snapshot, and the marketplace
+// subdirectories in them.
+func (mc *MonthlyCache) Recover() ([]string, error) {
+	bad := []string{}
+	for _, fc := range mc.snapshots(mc.now()) {
+		if _, err := os.Stat(fc.Dir); os.IsNotExist(err) {
+			continue
+		}
+		files, err := fc.Recover()
+		bad = append(bad, files...)
+		if err != nil {
+			return bad, err
+		}
+	}
+	return bad, nil
+}
+
+// RecoverCurrent is Recover for this month's snapshot only.
+func (mc *MonthlyCache) RecoverCurrent() ([]string, error) {
+	dir := mc.Dir(mc.now())
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	return mc.fileCache(dir).Recover()
+}
+
+// Rotate creates the snapshot directory for now's month and archives the
+// months past Retention.
+func (mc *MonthlyCache) Rotate(now time.Time) error {
+	err := os.MkdirAll(mc.Dir(now), 0755)
+	if err != nil || mc.Retention <= 0 || mc.sub != "" {
+		return err
+	}
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	oldest := first.AddDate(0, -(mc.Retention - 1), 0).Format(monthLayout)
+	for _, month := range mc.Months() {
+		if month >= oldest {
+			continue
+		}
+		dir := filepath.Join(mc.Root, month)
+		if mc.ArchiveDir != "" {
+			err = os.MkdirAll(mc.ArchiveDir, 0755)
+			if err == nil {
+				err = os.Rename(dir, filepath.Join(mc.ArchiveDir, month))
+			}
+		} else {
+			err = os.RemoveAll(dir)
+		}
+		if err != nil {
+			return err
+		}
+		mc.shared.mtx.Lock()
+		for d := range mc.shared.caches {
+			if d == dir || strings.HasPrefix(d, dir+string(filepath.Separator)) {
+				delete(mc.shared.caches, d)
+			}
+		}
+		mc.shared.mtx.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package amazon
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Price is how Rainforest reports every amount of money.
+type Price struct {
+	Symbol   string  `json:"symbol"`
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+	Raw      string  `json:"raw"`
+}
+
+func (p Price) IsZero() bool {
+	return p.Value == 0
+}
+
+// Product is the part of ProductData the rest of the code cares about,
+// flattened and cleaned up. Build it with NewProduct rather than reading
+// ProductData directly.
+type Product struct {
+	ASIN            string        `json:"asin"`
+	Marketplace     string        `json:"marketplace"`
+	Title           string        `json:"title"`
+	Format          string        `json:"format"`
+	Contributors    []Contributor `json:"contributors"`
+	Price           Price         `json:"price"`
+	ListPrice       Price         `json:"list_price"`
+	Availability    string        `json:"availability"`
+	Ranks           []Rank        `json:"ranks"`
+	PublicationDate time.Time     `json:"publication_date"`
+	Publisher       string        `json:"publisher"`
+	ISBN10          string        `json:"isbn_10"`
+	ISBN13          string        `json:"isbn_13"`
+	Pages           int           `json:"pages"`
+	Image           string        `json:"image"`
+	Description     string        `json:"description"`
+	Rating          float64       `json:"rating"`
+	RatingsTotal    int           `json:"ratings_total"`
+	// Stars counts the ratings by star, one star first.
+	Stars [5]int `json:"stars"`
+	// Variants are the other formats of this edition.
+	Variants []Variant `json:"variants"`
+	// AlsoBought and BoughtTogether are the ASINs Amazon lists under
+	// "customers also bought" and "frequently bought together".
+	AlsoBought     []string `json:"also_bought"`
+	BoughtTogether []string `json:"bought_together"`
+}
+
+type Variant struct {
+	ASIN   string `json:"asin"`
+	Format string `json:"format"`
+	Price  Price  `json:"price"`
+}
+
+// Contributor is an author, or anyone else credited with a Role like
+// "Illustrator" or "Translator".
+type Contributor struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	ASIN string `json:"asin,omitempty"`
+}
+
+type Rank struct {
+	Category string `json:"category"`
+	Rank     int    `json:"rank"`
+}
+
+var pagesPattern = regexp.MustCompile(`(?i)(\d[\d,]*)\s*pages`)
+
+func NewProduct(pd ProductData) Product {
+	src := pd.Product
+	p := Product{
+		ASIN:         src.Asin,
+		Marketplace:  pd.RequestParameters.AmazonDomain,
+		Title:        src.Title,
+		Format:       src.Format,
+		Price:        src.BuyboxWinner.Price,
+		ListPrice:    src.BuyboxWinner.Rrp,
+		Availability: src.BuyboxWinner.Availability.Raw,
+		Publisher:    src.Publisher,
+		ISBN10:       CleanGTIN(src.Isbn10),
+		ISBN13:       CleanGTIN(src.Isbn13),
+		Rating:       src.Rating,
+		RatingsTotal: src.RatingsTotal,
+		Image:        src.MainImage.Link,
+		Description:  strings.TrimSpace(src.BookDescription),
+	}
+	if p.Marketplace == "" {
+		p.Marketplace = MarketplaceUS.Domain
+	}
+	if p.ListPrice.IsZero() {
+		p.ListPrice = p.Price
+	}
+	if p.Availability == "" {
+		p.Availability = src.BuyboxWinner.Availability.Type
+	}
+	for _, a := range src.Authors {
+		name, role := splitRole(a.Name)
+		p.Contributors = append(p.Contributors, Contributor{Name: name, Role: role, ASIN: a.Asin})
+	}
+	for _, r := range src.BestsellersRank {
+		p.Ranks = append(p.Ranks, Rank{Category: r.Category, Rank: r.Rank})
+	}
+	p.Stars = starCounts(pd)
+	for _, v := range src.Variants {
+		if v.Asin != "" && v.Asin != p.ASIN {
+			p.Variants = append(p.Variants, Variant{ASIN: v.Asin, Format: v.Title, Price: v.Price})
+		}
+	}
+	for _, ab := range pd.AlsoBought {
+		if ab.Asin != "" && ab.Asin != p.ASIN {
+			p.AlsoBought = append(p.AlsoBought, ab.Asin)
+		}
+	}
+	for _, bt := range pd.FrequentlyBoughtTogether.Products {
+		if bt.Asin != "" && bt.Asin != p.ASIN {
+			p.BoughtTogether = append(p.BoughtTogether, bt.Asin)
+		}
+	}
+	if t, ok := ParseDate(src.PublicationDate); ok {
+		p.PublicationDate = t
+	}
+	// the specifications repeat some fields, sometimes when the fields
+	// themselves are blank
+	for _, spec := range src.Specifications {
+		name := strings.ToLower(spec.Name)
+		switch {
+		case name == "isbn-13" && p.ISBN13 == "":
+			p.ISBN13 = CleanGTIN(spec.Value)
+		case name == "isbn-10" && p.ISBN10 == "":
+			p.ISBN10 = CleanGTIN(spec.Value)
+		case name == "publication date" && p.PublicationDate.IsZero():
+			p.PublicationDate, _ = ParseDate(spec.Value)
+		}
+		if m := pagesPattern.FindStringSubmatch(spec.Value); m != nil && p.Pages == 0 {
+			p.Pages, _ = strconv.Atoi(strings.ReplaceAll(m[1], ",", ""))
+		}
+	}
+	return p
+}
+
+// starCounts uses the breakdown's counts, or works them out from its
+// percentages when Rainforest only sent those.
+func starCounts(pd ProductData) [5]int {
+	b := pd.Product.RatingBreakdown
+	counts := [5]int{b.OneStar.Count, b.TwoStar.Count, b.ThreeStar.Count, b.FourStar.Count, b.FiveStar.Count}
+	percents := [5]float32{b.OneStar.Percentage, b.TwoStar.Percentage, b.ThreeStar.Percentage, b.FourStar.Percentage, b.FiveStar.Percentage}
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		for i, p := range percents {
+			counts[i] = int(float64(p)/100*float64(pd.Product.RatingsTotal) + 0.5)
+		}
+	}
+	return counts
+}
+
+// Authors are the contributors credited as authors.
+func (p Product) Authors() []string {
+	names := []string{}
+	for _, c := range p.Contributors {
+		if c.Role == "Author" {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Rank returns the rank in the first category containing category, or
+// the first one when category is blank.
+func (p Product) Rank(category string) (int, bool) {
+	for _, r := range p.Ranks {
+		if strings.Contains(r.Category, category) {
+			return r.Rank, true
+		}
+	}
+	return 0, false
+}
+
+// splitRole takes apart names like "Jane Doe (Illustrator)", names without
+// a role are authors.
+func splitRole(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		return strings.TrimSpace(name[:i]), name[i+2 : len(name)-1]
+	}
+	return name, "Author"
+}
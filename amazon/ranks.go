@@ -0,0 +1,163 @@
+package amazon
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type RankEventKind string
+
+const (
+	RankEntered  RankEventKind = "entered"
+	RankLeft     RankEventKind = "left"
+	RankImproved RankEventKind = "improved"
+	RankDropped  RankEventKind = "dropped"
+)
+
+// RankEvent is a notable move in one bestseller category between the
+// start and the end of a window, ready to be shown as Message.
+type RankEvent struct {
+	ASIN        string        `json:"asin"`
+	Marketplace string        `json:"marketplace"`
+	Category    string        `json:"category"`
+	Kind        RankEventKind `json:"kind"`
+	// Threshold is set for entered and left, the top N crossed.
+	Threshold int       `json:"threshold,omitempty"`
+	From      int       `json:"from,omitempty"`
+	To        int       `json:"to,omitempty"`
+	Change    float64   `json:"change,omitempty"`
+	At        time.Time `json:"at"`
+	Message   string    `json:"message"`
+}
+
+// RankAlerts decides which moves are events. Crossing one of Thresholds,
+// like into the top 100, is one. So is the rank getting better or worse
+// by at least Change, as a fraction of the old rank.
+type RankAlerts struct {
+	Thresholds []int
+	Change     float64
+}
+
+var DefaultRankAlerts = RankAlerts{
+	Thresholds: []int{10, 100, 1000},
+	Change:     0.5,
+}
+
+type RankPoint struct {
+	Time time.Time
+	Rank int
+}
+
+// RankHistory picks the ranks in category out of points, which come from
+// PriceHistory.Points.
+func RankHistory(points []PricePoint, category string) []RankPoint {
+	ranks := []RankPoint{}
+	for _, pp := range points {
+		if r, ok := pp.BestsellersRank[category]; ok {
+			ranks = append(ranks, RankPoint{Time: pp.Time, Rank: r})
+		}
+	}
+	return ranks
+}
+
+// RankEvents compares the ranks asin had when the window started with the
+// latest ones, in every category it has been ranked in.
+func (ph *PriceHistory) RankEvents(asin, marketplace string, window time.Duration, now time.Time, alerts RankAlerts) ([]RankEvent, error) {
+	points, err := ph.Points(asin, marketplace)
+	if err != nil {
+		return nil, err
+	}
+	return RankEventsFor(points, now.Add(-window), now, alerts), nil
+}
+
+// RankEventsFor uses the last point at or before since as the start,
+// falling back to the first point after it, and the last point at or
+// before now as the end.
+func RankEventsFor(points []PricePoint, since, now time.Time, alerts RankAlerts) []RankEvent {
+	var start, end *PricePoint
+	for i := range points {
+		pp := &points[i]
+		if pp.Time.After(now) || len(pp.BestsellersRank) == 0 {
+			continue
+		}
+		if !pp.Time.After(since) || start == nil {
+			start = pp
+		}
+		end = pp
+	}
+	if start == nil || start == end {
+		return nil
+	}
+
+	categories := []string{}
+	for c := range end.BestsellersRank {
+		categories = append(categories, c)
+	}
+	for c := range start.BestsellersRank {
+		if _, ok := end.BestsellersRank[c]; !ok {
+			categories = append(categories, c)
+		}
+	}
+	sort.Strings(categories)
+
+	thresholds := append([]int{}, alerts.Thresholds...)
+	sort.Ints(thresholds)
+	events := []RankEvent{}
+	for _, c := range categories {
+		from, to := start.BestsellersRank[c], end.BestsellersRank[c]
+		base := RankEvent{
+			ASIN:        end.ASIN,
+			Marketplace: end.Marketplace,
+			Category:    c,
+			From:        from,
+			To:          to,
+			At:          end.Time,
+		}
+		if e, ok := crossing(base, thresholds); ok {
+			events = append(events, e)
+		}
+		if from == 0 || to == 0 || alerts.Change <= 0 {
+			continue
+		}
+		change := float64(from-to) / float64(from)
+		if math.Abs(change) < alerts.Change {
+			continue
+		}
+		e := base
+		e.Change = change
+		if change > 0 {
+			e.Kind = RankImproved
+			e.Message = fmt.Sprintf("rank improved %.0f%% in %s, %d to %d", change*100, c, from, to)
+		} else {
+			e.Kind = RankDropped
+			e.Message = fmt.Sprintf("rank dropped %.0f%% in %s, %d to %d", -change*100, c, from, to)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// crossing reports the tightest top N entered, or the widest one left,
+// since falling from 5th to 500th is leaving the top 100 more than the
+// top 10. A rank of 0 means unranked.
+func crossing(e RankEvent, thresholds []int) (RankEvent, bool) {
+	in := func(rank, t int) bool { return rank > 0 && rank <= t }
+	for _, t := range thresholds {
+		if in(e.To, t) && !in(e.From, t) {
+			e.Kind, e.Threshold = RankEntered, t
+			e.Message = fmt.Sprintf("entered top %d in %s", t, e.Category)
+			return e, true
+		}
+	}
+	for i := len(thresholds) - 1; i >= 0; i-- {
+		t := thresholds[i]
+		if in(e.From, t) && !in(e.To, t) {
+			e.Kind, e.Threshold = RankLeft, t
+			e.Message = fmt.Sprintf("left top %d in %s", t, e.Category)
+			return e, true
+		}
+	}
+	return e, false
+}
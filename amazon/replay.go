@@ -0,0 +1,187 @@
+package amazon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type RecordMode int
+
+const (
+	// Replay serves recorded responses and never touches the network.
+	Replay RecordMode = iota
+	// Record sends requests on and saves what comes back.
+	Record
+)
+
+const redacted = "REDACTED"
+
+// Recorder is an http.RoundTripper that saves Rainforest traffic to Dir
+// and plays it back, so scrapers can be developed and tested without
+// spending credits. Requests are matched on method, URL and body, with the
+// api_key parameter redacted so recordings can be shared. Rate limits and
+// server errors are not recorded, a retry would get a real answer.
+type Recorder struct {
+	Dir  string
+	Mode RecordMode
+	// Transport is used when recording, nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Fixture is one recorded exchange, stored as JSON in the Recorder's Dir.
+type Fixture struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+func NewRecorder(dir string, mode RecordMode) *Recorder {
+	return &Recorder{Dir: dir, Mode: mode}
+}
+
+// Client returns an HTTP client using r, for Client.HTTPClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	u, key := redactURL(req.URL)
+	filename := r.fixtureFile(req.Method, u, body)
+
+	if r.Mode == Replay {
+		f, err := readFixture(filename)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w for %s %s", ErrNoFixture, req.Method, u)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return f.response(req), nil
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return resp, nil
+	}
+
+	f := Fixture{
+		Method:      req.Method,
+		URL:         u,
+		RequestBody: redactString(string(body), key),
+		Status:      resp.StatusCode,
+		Body:        redactString(string(data), key),
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		f.Header = http.Header{"Content-Type": {ct}}
+	}
+	err = writeJSONAtomic(filename, f, true)
+	if err != nil {
+		return nil, fmt.Errorf("amazon: recording %s: %w", u, err)
+	}
+	return resp, nil
+}
+
+// fixtureFile names fixtures by a hash of the request, prefixed with the
+// request type so the directory is browsable.
+func (r *Recorder) fixtureFile(method, u string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+u+"\n")
+	h.Write(body)
+	sum := hex.EncodeToString(h.Sum(nil))[:16]
+
+	prefix := "request"
+	if parsed, err := url.Parse(u); err == nil {
+		if t := parsed.Query().Get("type"); t != "" {
+			prefix = t
+		} else if base := filepath.Base(parsed.Path); base != "/" && base != "." {
+			prefix = base
+		}
+	}
+	return filepath.Join(r.Dir, prefix+"-"+sum+".json")
+}
+
+func readFixture(filename string) (Fixture, error) {
+	var f Fixture
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return f, fmt.Errorf("%w: %s: %v", ErrCacheCorrupt, filename, err)
+	}
+	return f, nil
+}
+
+func (f Fixture) response(req *http.Request) *http.Response {
+	header := f.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(f.Body)),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
+
+// redactURL returns u with its query sorted and api_key replaced, along
+// with the key that was removed.
+func redactURL(u *url.URL) (string, string) {
+	c := *u
+	q := c.Query()
+	key := q.Get("api_key")
+	if key != "" {
+		q.Set("api_key", redacted)
+	}
+	c.RawQuery = q.Encode()
+	return c.String(), key
+}
+
+func redactString(s, key string) string {
+	if key == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, key, redacted)
+}
@@ -0,0 +1,51 @@
+package amazon
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Review struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	BodyHTML string `json:"body_html"`
+	Link     string `json:"link,omitempty"`
+	Rating   int    `json:"rating"`
+	Date     struct {
+		Raw string    `json:"raw"`
+		Utc time.Time `json:"utc"`
+	} `json:"date"`
+	Profile          ReviewProfile `json:"profile"`
+	VineProgram      bool          `json:"vine_program"`
+	VerifiedPurchase bool          `json:"verified_purchase"`
+	ReviewCountry    string        `json:"review_country"`
+	IsGlobalReview   bool          `json:"is_global_review"`
+	HelpfulVotes     int           `json:"helpful_votes,omitempty"`
+}
+
+// ReviewProfile is the reviewer. Depending on the review Rainforest sends
+// anything from a bare name string to an object with a link, id and image,
+// all of which decode into this.
+type ReviewProfile struct {
+	Name  string `json:"name"`
+	Link  string `json:"link,omitempty"`
+	ID    string `json:"id,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+func (rp *ReviewProfile) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*rp = ReviewProfile{Name: name}
+		return nil
+	}
+	type plain ReviewProfile
+	var p plain
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return err
+	}
+	*rp = ReviewProfile(p)
+	return nil
+}
@@ -0,0 +1,157 @@
+package amazon
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	profileType   = reflect.TypeOf(ReviewProfile{})
+	unmarshalType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// SchemaDrift compares a raw response with the struct v it is decoded
+// into, normally a *ProductData, and reports the fields encoding/json
+// would drop, either because v has nowhere to put them or because the
+// JSON type does not fit. Each finding is a path like
+// "product.top_reviews[].badge", so run it over a few saved responses to
+// notice when Rainforest changes its API.
+func SchemaDrift(data []byte, v interface{}) ([]string, error) {
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	drift(doc, reflect.TypeOf(v), "", found)
+	report := make([]string, 0, len(found))
+	for f := range found {
+		report = append(report, f)
+	}
+	sort.Strings(report)
+	return report, nil
+}
+
+func drift(doc interface{}, t reflect.Type, path string, found map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if doc == nil || t.Kind() == reflect.Interface || t == rawType {
+		return
+	}
+	if t == profileType {
+		if _, ok := doc.(string); ok {
+			return
+		}
+	} else if t == timeType || reflect.PtrTo(t).Implements(unmarshalType) {
+		// custom decoding, only its own errors would tell
+		return
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for k, v := range d {
+				drift(v, t.Elem(), joinPath(path, k), found)
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for k, v := range d {
+				ft, ok := fields[k]
+				if !ok {
+					ft, ok = foldField(fields, k)
+				}
+				if !ok {
+					found[joinPath(path, k)] = true
+					continue
+				}
+				drift(v, ft, joinPath(path, k), found)
+			}
+		default:
+			found[mismatch(path, "object", t)] = true
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			found[mismatch(path, "array", t)] = true
+			return
+		}
+		for _, v := range d {
+			drift(v, t.Elem(), path+"[]", found)
+		}
+	case string:
+		if t.Kind() != reflect.String {
+			found[mismatch(path, "string", t)] = true
+		}
+	case float64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if d != float64(int64(d)) {
+				found[mismatch(path, "fraction", t)] = true
+			}
+		case reflect.Float32, reflect.Float64:
+		default:
+			found[mismatch(path, "number", t)] = true
+		}
+	case bool:
+		if t.Kind() != reflect.Bool {
+			found[mismatch(path, "bool", t)] = true
+		}
+	}
+}
+
+// jsonFields maps the JSON names of t's fields to their types, following
+// embedded structs the way encoding/json does.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// foldField matches key case insensitively, as encoding/json does when
+// there is no exact match.
+func foldField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func mismatch(path, got string, want reflect.Type) string {
+	return fmt.Sprintf("%s (%s, want %s)", path, got, want.Kind())
+}
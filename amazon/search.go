@@ -0,0 +1,112 @@
+package amazon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SearchResult struct {
+	Position    int    `json:"position"`
+	Title       string `json:"title"`
+	Asin        string `json:"asin"`
+	Link        string `json:"link"`
+	Image       string `json:"image"`
+	IsSponsored bool   `json:"sponsored"`
+	Authors     []struct {
+		Name string `json:"name"`
+		Link string `json:"link"`
+	} `json:"authors"`
+	Rating       float64 `json:"rating"`
+	RatingsTotal int     `json:"ratings_total"`
+	Prices       []struct {
+		Name      string `json:"name"`
+		IsPrimary bool   `json:"is_primary"`
+		Price
+	} `json:"prices"`
+}
+
+// Format is the name Amazon gave the result's own price, such as
+// "Paperback" or "Kindle", it can be compared with the *Types lists.
+func (sr SearchResult) Format() string {
+	for _, p := range sr.Prices {
+		if p.IsPrimary {
+			return p.Name
+		}
+	}
+	if len(sr.Prices) > 0 {
+		return sr.Prices[0].Name
+	}
+	return ""
+}
+
+type searchResponse struct {
+	RequestInfo   RequestInfo    `json:"request_info"`
+	SearchResults []SearchResult `json:"search_results"`
+}
+
+// Search runs a Rainforest search in the client's marketplace for the
+// given title, author and publisher, any of which may be blank. Searches
+// are never essential, so they stop once the ledger is down to its reserve.
+func (c *Client) Search(title, author, publisher string) ([]SearchResult, error) {
+	return c.SearchContext(context.Background(), title, author, publisher)
+}
+
+func (c *Client) SearchContext(ctx context.Context, title, author, publisher string) ([]SearchResult, error) {
+	terms := []string{}
+	for _, t := range []string{title, author, publisher} {
+		if t = strings.TrimSpace(t); t != "" {
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("amazon: nothing to search for")
+	}
+	if c.Ledger != nil {
+		err := c.Ledger.Allow(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := c.fetch(ctx, c.requestURL(url.Values{
+		"amazon_domain": {c.marketplace().Domain},
+		"type":          {"search"},
+		"search_term":   {strings.Join(terms, " ")},
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var sr searchResponse
+	err = json.Unmarshal(body, &sr)
+	if err != nil {
+		return nil, fmt.Errorf("amazon: decoding search response: %w", err)
+	}
+	c.record(sr.RequestInfo)
+	return sr.SearchResults, nil
+}
+
+var dateLayouts = []string{
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan. 2006",
+	"2006-01-02",
+	"2006/1/2",
+	"January 2006",
+}
+
+// ParseDate reads the publication dates Amazon shows, which change format
+// between marketplaces.
+func ParseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
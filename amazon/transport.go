@@ -0,0 +1,185 @@
+package amazon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests out to at most PerSecond a second, shared by
+// every goroutine using it. A zero PerSecond does not limit anything.
+type RateLimiter struct {
+	PerSecond float64
+
+	mtx  sync.Mutex
+	next time.Time
+}
+
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	return &RateLimiter{PerSecond: perSecond}
+}
+
+// Wait blocks until the next request may go out or ctx is done.
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	if rl == nil || rl.PerSecond <= 0 {
+		return ctx.Err()
+	}
+	interval := time.Duration(float64(time.Second) / rl.PerSecond)
+
+	rl.mtx.Lock()
+	now := time.Now()
+	at := rl.next
+	if at.Before(now) {
+		at = now
+	}
+	rl.next = at.Add(interval)
+	rl.mtx.Unlock()
+
+	return sleep(ctx, at.Sub(now))
+}
+
+// RetryPolicy controls how often a failed request is retried. Network
+// errors, 429s and 5xx responses are retried, waiting BaseDelay doubled
+// for each attempt up to MaxDelay with up to half of it added as jitter.
+// A Retry-After header from Rainforest is used when it asks for longer.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+func (rp RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	d := rp.BaseDelay << attempt
+	if d <= 0 || (rp.MaxDelay > 0 && d > rp.MaxDelay) {
+		d = rp.MaxDelay
+	}
+	if d > 0 {
+		d += time.Duration(rand.Int63n(int64(d)/2 + 1))
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+// retryable is only asked once the caller's context is known to be live,
+// so a deadline here is the per attempt Timeout.
+func retryable(err error) bool {
+	if errors.Is(err, ErrNoFixture) {
+		return false
+	}
+	var status ErrHTTPStatus
+	if errors.As(err, &status) {
+		return status.Code == http.StatusTooManyRequests || status.Code >= 500
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// fetch sends a GET through the rate limiter and retry policy, returning
+// the body of the first 200 response.
+func (c *Client) fetch(ctx context.Context, url string) ([]byte, error) {
+	return c.send(ctx, http.MethodGet, url, nil, true)
+}
+
+// send is fetch for any method. Requests that change something, which
+// includes a few GETs like starting a collection, pass retry as false and
+// are only sent once since a retry could repeat the change.
+func (c *Client) send(ctx context.Context, method, url string, body []byte, retry bool) ([]byte, error) {
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 || !retry {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		err = c.Limiter.Wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var resp []byte
+		var wait time.Duration
+		resp, wait, err = c.sendOnce(ctx, method, url, body)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !retryable(err) || attempt == attempts-1 {
+			break
+		}
+		err = sleep(ctx, c.Retry.delay(attempt, wait))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, url string, body []byte) ([]byte, time.Duration, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, retryAfter(resp.Header.Get("Retry-After")), ErrHTTPStatus{Code: resp.StatusCode}
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, 0, err
+}
+
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
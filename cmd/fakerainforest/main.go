@@ -0,0 +1,36 @@
+// Command fakerainforest serves a directory of cached products the way
+// Rainforest would, so scrapers can run without an API key:
+//
+//	fakerainforest -dir amazon/2024-05 -addr :8089
+//
+// then point a Client's BaseURL at http://localhost:8089/request and its
+// CollectionsURL at http://localhost:8089/collections.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/acsellers/ln_shared/amazon/amazontest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8089", "address to listen on")
+	dir := flag.String("dir", "", "directory of product JSON files")
+	apiKey := flag.String("api-key", "", "require this api_key")
+	credits := flag.Int("credits", 0, "credits before requests fail with 402, 0 is unlimited")
+	errorRate := flag.Float64("error-rate", 0, "fraction of requests answered with a 500")
+	limitRate := flag.Float64("limit-rate", 0, "fraction of requests answered with a 429")
+	retryAfter := flag.Int("retry-after", 1, "Retry-After seconds sent with 429s")
+	flag.Parse()
+
+	s := amazontest.NewServer(*dir)
+	s.APIKey = *apiKey
+	s.Credits = *credits
+	s.ErrorRate = *errorRate
+	s.RateLimitRate = *limitRate
+	s.RetryAfter = *retryAfter
+	log.Printf("serving %s on %s", *dir, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,34 @@
+// Command migratecache rewrites an Amazon cache directory in place, for
+// example to gzip every product file:
+//
+//	migratecache -dir amazon -codec gzip -slim
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+func main() {
+	dir := flag.String("dir", amazon.DefaultCacheRoot, "cache directory, subdirectories are included")
+	codec := flag.String("codec", "gzip", "gzip or none")
+	slim := flag.Bool("slim", false, "drop the fields the pipeline does not use")
+	flag.Parse()
+
+	var c amazon.Codec
+	switch *codec {
+	case "gzip":
+		c = amazon.Gzip
+	case "none":
+	default:
+		log.Fatalf("unknown codec %q", *codec)
+	}
+	n, err := amazon.MigrateCache(*dir, c, *slim)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("rewrote %d files in %s\n", n, *dir)
+}
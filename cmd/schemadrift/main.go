@@ -0,0 +1,81 @@
+// Command schemadrift reports the fields in raw Rainforest product
+// responses that ProductData does not decode. The cache is no use for
+// this, it holds ProductData re-encoded with those fields already gone, so
+// record some lookups with a Recorder first, by running anything that uses
+// amazon.Default with RAINFOREST_FIXTURES=fixtures and RAINFOREST_RECORD=1
+// set, then:
+//
+//	schemadrift fixtures/product-*.json
+//
+// Files that are not recordings are read as a response body saved as is.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+func main() {
+	flag.Parse()
+	counts := map[string]int{}
+	files := 0
+	for _, filename := range flag.Args() {
+		data, ok, err := readResponse(filename)
+		if err != nil {
+			log.Println(filename, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		report, err := amazon.SchemaDrift(data, &amazon.ProductData{})
+		if err != nil {
+			log.Println(filename, err)
+			continue
+		}
+		files++
+		for _, field := range report {
+			counts[field]++
+		}
+	}
+
+	fields := make([]string, 0, len(counts))
+	for f := range counts {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		fmt.Printf("%6d  %s\n", counts[f], f)
+	}
+	fmt.Printf("%d fields dropped across %d responses\n", len(fields), files)
+	if len(fields) > 0 {
+		os.Exit(1)
+	}
+}
+
+// readResponse returns the product response in filename, unwrapping a
+// recorded Fixture. Recordings of other requests or failed ones are
+// skipped.
+func readResponse(filename string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	var f amazon.Fixture
+	if json.Unmarshal(data, &f) != nil || f.URL == "" {
+		return data, true, nil
+	}
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Query().Get("type") != "product" || f.Status != http.StatusOK {
+		return nil, false, nil
+	}
+	return []byte(f.Body), true, nil
+}
@@ -0,0 +1,140 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// ProvenanceKey is the Volume.Extra entry recording where filled in fields
+// came from, a map of the field's JSON name to a source like
+// "amazon:B0XXXXXXXX".
+const ProvenanceKey = "provenance"
+
+type EnrichedField struct {
+	SeriesID string `json:"series_id"`
+	VolumeID string `json:"volume_id"`
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	ASIN     string `json:"asin"`
+}
+
+type EnrichReport struct {
+	Fields []EnrichedField `json:"fields"`
+}
+
+// Counts is how many volumes had each field filled in.
+func (r EnrichReport) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, f := range r.Fields {
+		counts[f.Field]++
+	}
+	return counts
+}
+
+func (r EnrichReport) String() string {
+	sb := &strings.Builder{}
+	for _, f := range r.Fields {
+		value := f.Value
+		if runes := []rune(value); len(runes) > 60 {
+			value = string(runes[:57]) + "..."
+		}
+		fmt.Fprintf(sb, "%s/%s %s from %s: %s\n", f.SeriesID, f.VolumeID, f.Field, f.ASIN, value)
+	}
+	return sb.String()
+}
+
+// Enrich fills the blank fields of the volumes in series from the Amazon
+// products for their amazon.com ASINs. Print fields come from the
+// paperback, or the hardcover, and the digital release date from the
+// Kindle edition. Fields already set are never touched, and each one that
+// is filled is recorded under ProvenanceKey in the volume's Extra.
+func Enrich(series []Series, products []amazon.ProductData) EnrichReport {
+	byASIN := map[string]amazon.Product{}
+	for _, pd := range products {
+		if p := amazon.NewProduct(pd); p.ASIN != "" {
+			byASIN[p.ASIN] = p
+		}
+	}
+
+	report := EnrichReport{Fields: []EnrichedField{}}
+	for i := range series {
+		for j := range series[i].Volumes {
+			report.Fields = append(report.Fields, enrichVolume(series[i].ID, &series[i].Volumes[j], byASIN)...)
+		}
+	}
+	return report
+}
+
+func enrichVolume(seriesID string, v *Volume, byASIN map[string]amazon.Product) []EnrichedField {
+	find := func(slots ...string) (amazon.Product, bool) {
+		for _, slot := range slots {
+			if p, ok := byASIN[v.Amazon.ASIN(slot)]; ok && p.ASIN != "" {
+				return p, true
+			}
+		}
+		return amazon.Product{}, false
+	}
+	paper, hasPaper := find(SlotPaperback, SlotHardcover)
+	digital, hasDigital := find(SlotDigital)
+	first, hasFirst := find(SlotPaperback, SlotHardcover, SlotDigital, SlotAudiobook)
+
+	filled := []EnrichedField{}
+	fill := func(field string, current *string, p amazon.Product, value string) {
+		if *current != "" || value == "" {
+			return
+		}
+		*current = value
+		filled = append(filled, EnrichedField{SeriesID: seriesID, VolumeID: v.ID, Field: field, Value: value, ASIN: p.ASIN})
+	}
+	fillList := func(field string, current *[]string, p amazon.Product, role string) {
+		names := []string{}
+		for _, c := range p.Contributors {
+			if c.Role == role {
+				names = append(names, c.Name)
+			}
+		}
+		if len(*current) > 0 || len(names) == 0 {
+			return
+		}
+		*current = names
+		filled = append(filled, EnrichedField{SeriesID: seriesID, VolumeID: v.ID, Field: field, Value: strings.Join(names, ", "), ASIN: p.ASIN})
+	}
+
+	if hasPaper {
+		isbn := paper.ISBN13
+		if isbn == "" {
+			isbn = paper.ISBN10
+		}
+		fill("isbn", &v.ISBN, paper, isbn)
+		if !paper.PublicationDate.IsZero() {
+			fill("print_release", &v.PrintRelease, paper, paper.PublicationDate.Format("2006-01-02"))
+		}
+	}
+	if hasDigital && !digital.PublicationDate.IsZero() {
+		fill("digital_release", &v.DigitalRelease, digital, digital.PublicationDate.Format("2006-01-02"))
+	}
+	if hasFirst {
+		fillList("authors", &v.Authors, first, "Author")
+		fillList("illustrators", &v.Illustrators, first, "Illustrator")
+		fillList("translators", &v.Translators, first, "Translator")
+		fill("cover_image", &v.CoverImage, first, first.Image)
+		fill("description", &v.Description, first, first.Description)
+	}
+
+	if len(filled) > 0 {
+		if v.Extra == nil {
+			v.Extra = map[string]interface{}{}
+		}
+		provenance, _ := v.Extra[ProvenanceKey].(map[string]interface{})
+		if provenance == nil {
+			provenance = map[string]interface{}{}
+		}
+		for _, f := range filled {
+			provenance[f.Field] = "amazon:" + f.ASIN
+		}
+		v.Extra[ProvenanceKey] = provenance
+	}
+	return filled
+}
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"time"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// FormatConflict is a format that had more than one ASIN to choose from,
+// ASIN is the one used and Other the one left out.
+type FormatConflict struct {
+	Domain string `json:"domain"`
+	Slot   string `json:"slot"`
+	ASIN   string `json:"asin"`
+	Other  string `json:"other"`
+	Reason string `json:"reason"`
+}
+
+type formatOption struct {
+	asin    string
+	format  string
+	price   float64
+	current bool
+}
+
+var slotTypes = map[string][]string{
+	SlotPaperback: amazon.PaperbackTypes,
+	SlotHardcover: amazon.HardcoverTypes,
+	SlotDigital:   amazon.DigitalTypes,
+	SlotAudiobook: amazon.AudiobookTypes,
+}
+
+// Resolve fills the ASIN and price slots for the marketplace pd came from
+// using the product itself and its format Variants. ASINs already set are
+// kept, with their price updated when pd has one. Whenever a slot has a
+// choice to make the choice is reported, otherwise a second paperback
+// edition would silently vanish.
+func (ad *AmazonData) Resolve(pd amazon.ProductData) []FormatConflict {
+	p := amazon.NewProduct(pd)
+	domain := p.Marketplace
+	md := ad.In(domain)
+	if m, ok := amazon.MarketplaceByDomain(domain); ok && md.Currency == "" {
+		md.Currency = m.Currency
+	}
+
+	options := map[string][]formatOption{}
+	if p.ASIN != "" {
+		if slot := FormatSlot(p.Format); slot != "" {
+			options[slot] = append(options[slot], formatOption{
+				asin:    p.ASIN,
+				format:  p.Format,
+				price:   p.Price.Value,
+				current: true,
+			})
+		}
+	}
+	for _, v := range p.Variants {
+		slot := FormatSlot(v.Format)
+		if slot == "" {
+			continue
+		}
+		options[slot] = append(options[slot], formatOption{asin: v.ASIN, format: v.Format, price: v.Price.Value})
+	}
+
+	conflicts := []FormatConflict{}
+	for _, slot := range []string{SlotPaperback, SlotHardcover, SlotDigital, SlotAudiobook} {
+		opts := options[slot]
+		if len(opts) == 0 {
+			continue
+		}
+		chosen := chooseFormat(slot, opts)
+		existing := md.asin(slot)
+		if existing != "" && existing != chosen.asin {
+			for _, o := range opts {
+				if o.asin == existing {
+					chosen = o
+				}
+			}
+		}
+		if existing != "" && existing != chosen.asin {
+			conflicts = append(conflicts, FormatConflict{
+				Domain: domain, Slot: slot, ASIN: existing, Other: chosen.asin,
+				Reason: "already set to a different ASIN",
+			})
+			continue
+		}
+		for _, o := range opts {
+			if o.asin != chosen.asin {
+				conflicts = append(conflicts, FormatConflict{
+					Domain: domain, Slot: slot, ASIN: chosen.asin, Other: o.asin,
+					Reason: "more than one " + slot + " edition, " + chosen.format + " was used over " + o.format,
+				})
+			}
+		}
+		md.set(slot, chosen.asin, float32(chosen.price))
+	}
+	ad.Set(domain, md)
+	return conflicts
+}
+
+// chooseFormat prefers the product that was looked up, then goes by the
+// order of the type lists, like LookupVariant.
+func chooseFormat(slot string, opts []formatOption) formatOption {
+	for _, o := range opts {
+		if o.current {
+			return o
+		}
+	}
+	for _, t := range slotTypes[slot] {
+		for _, o := range opts {
+			if o.format == t {
+				return o
+			}
+		}
+	}
+	return opts[0]
+}
+
+func (md MarketplaceData) asin(slot string) string {
+	switch slot {
+	case SlotPaperback:
+		return md.PaperbackASIN
+	case SlotHardcover:
+		return md.HardcoverASIN
+	case SlotDigital:
+		return md.DigitalASIN
+	case SlotAudiobook:
+		return md.AudiobookASIN
+	}
+	return ""
+}
+
+// set only replaces a known price with a new one, a variant without a
+// price listed should not zero out the price we had.
+func (md *MarketplaceData) set(slot, asin string, price float32) {
+	var asinField *string
+	var priceField *float32
+	switch slot {
+	case SlotPaperback:
+		asinField, priceField = &md.PaperbackASIN, &md.PaperbackPrice
+	case SlotHardcover:
+		asinField, priceField = &md.HardcoverASIN, &md.HardcoverPrice
+	case SlotDigital:
+		asinField, priceField = &md.DigitalASIN, &md.DigitalPrice
+	case SlotAudiobook:
+		asinField, priceField = &md.AudiobookASIN, &md.AudiobookPrice
+	default:
+		return
+	}
+	*asinField = asin
+	if price > 0 {
+		*priceField = price
+	}
+}
+
+// PriceStats summarizes the price history of one format in a marketplace,
+// such as the lowest price in the last 90 days.
+func (ad AmazonData) PriceStats(h *amazon.PriceHistory, domain, slot string, window time.Duration) (amazon.PriceStats, error) {
+	asin := ad.In(domain).asin(slot)
+	if asin == "" {
+		return amazon.PriceStats{}, nil
+	}
+	return h.Stats(asin, domain, window, time.Now())
+}
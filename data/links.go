@@ -0,0 +1,206 @@
+package data
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// The sections of a Volume purchase links can be in.
+const (
+	LinksPurchase = "purchase"
+	LinksDigital  = "digital"
+	LinksPrint    = "print"
+)
+
+var (
+	asinPathPattern = regexp.MustCompile(`(?i)/(?:dp|gp/product|gp/aw/d|exec/obidos/asin|o/asin|product|d)/([a-z0-9]{10})(?:[/?&#.]|$)`)
+	bareASINPattern = regexp.MustCompile(`(?i)^/([a-z0-9]{10})/?$`)
+
+	shortLinkHosts = []string{"amzn.to", "a.co", "amzn.eu", "amzn.asia"}
+)
+
+// ResolveShortLink turns an amzn.to or a.co link into the full link it
+// redirects to. It is nil by default, which leaves short links alone
+// rather than making requests, set it to FollowShortLink to follow them.
+var ResolveShortLink func(link string) (string, error)
+
+// FollowShortLink asks the short link service where link goes without
+// following the redirect any further.
+func FollowShortLink(link string) (string, error) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Head(link)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); loc != "" {
+		return loc, nil
+	}
+	return link, nil
+}
+
+// AmazonLink is what ParseAmazonLink found in a link. Short is set for
+// short links, which only have an ASIN once resolved.
+type AmazonLink struct {
+	ASIN   string
+	Domain string
+	Short  bool
+}
+
+// ParseAmazonLink pulls the ASIN and marketplace out of the many shapes an
+// Amazon product link comes in: /dp/, /gp/product/, the mobile /gp/aw/d/,
+// old /exec/obidos/ links, amzn.com/ASIN and an asin query parameter.
+func ParseAmazonLink(link string) (AmazonLink, bool) {
+	link = strings.TrimSpace(link)
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return AmazonLink{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "smile.", "m."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	for _, short := range shortLinkHosts {
+		if host == short {
+			return AmazonLink{Short: true}, true
+		}
+	}
+
+	al := AmazonLink{}
+	switch {
+	case host == "amzn.com":
+		al.Domain = amazon.MarketplaceUS.Domain
+	default:
+		m, ok := amazon.MarketplaceByDomain(host)
+		if !ok {
+			return AmazonLink{}, false
+		}
+		al.Domain = m.Domain
+	}
+
+	if m := asinPathPattern.FindStringSubmatch(u.Path); m != nil {
+		al.ASIN = m[1]
+	} else if m := bareASINPattern.FindStringSubmatch(u.Path); m != nil && host == "amzn.com" {
+		al.ASIN = m[1]
+	} else {
+		al.ASIN = u.Query().Get("asin")
+	}
+	al.ASIN = strings.ToUpper(al.ASIN)
+	if !validASIN(al.ASIN) {
+		return AmazonLink{}, false
+	}
+	return al, true
+}
+
+// validASIN accepts Amazon's own B ASINs and ISBN-10s, which it uses as
+// the ASIN of print books.
+func validASIN(asin string) bool {
+	if len(asin) != 10 {
+		return false
+	}
+	if asin[0] == 'B' {
+		return true
+	}
+	return amazon.ValidGTIN(asin)
+}
+
+// linkSlot decides which slot an ASIN from a link belongs in. The section
+// says print or digital, after that an ISBN-10 is a print book and a B
+// ASIN is taken to be Kindle, though some print books have one.
+func linkSlot(section, asin string) string {
+	switch section {
+	case LinksDigital:
+		return SlotDigital
+	case LinksPrint:
+		return SlotPaperback
+	}
+	if asin[0] == 'B' {
+		return SlotDigital
+	}
+	return SlotPaperback
+}
+
+// ApplyAmazonLinks fills empty AmazonData slots from the ASINs in the
+// volume's purchase links, in every marketplace. A link disagreeing with
+// an ASIN that is already set, or with another link, is reported rather
+// than applied. Short links are only used when ResolveShortLink is set.
+func (v *Volume) ApplyAmazonLinks() []FormatConflict {
+	conflicts := []FormatConflict{}
+	sections := []struct {
+		name  string
+		links []PurchaseLink
+	}{
+		{LinksPrint, v.PrintLinks},
+		{LinksDigital, v.DigitalLinks},
+		{LinksPurchase, v.PurchaseLinks},
+	}
+	from := map[string]string{}
+	for _, section := range sections {
+		for _, pl := range section.links {
+			al, ok := parsePurchaseLink(pl)
+			if !ok {
+				continue
+			}
+			slot := linkSlot(section.name, al.ASIN)
+			md := v.Amazon.In(al.Domain)
+			key := al.Domain + "/" + slot
+			existing := md.asin(slot)
+			switch {
+			case existing == al.ASIN:
+				from[key] = pl.Link
+			case existing == "":
+				if m, ok := amazon.MarketplaceByDomain(al.Domain); ok && md.Currency == "" {
+					md.Currency = m.Currency
+				}
+				md.set(slot, al.ASIN, 0)
+				v.Amazon.Set(al.Domain, md)
+				from[key] = pl.Link
+			case from[key] != "":
+				conflicts = append(conflicts, FormatConflict{
+					Domain: al.Domain, Slot: slot, ASIN: existing, Other: al.ASIN,
+					Reason: "purchase links disagree, " + from[key] + " was used over " + pl.Link,
+				})
+			default:
+				conflicts = append(conflicts, FormatConflict{
+					Domain: al.Domain, Slot: slot, ASIN: existing, Other: al.ASIN,
+					Reason: "already set to a different ASIN than " + pl.Link,
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// parsePurchaseLink prefers the marketplace of the vendor NewPurchaseLink
+// picked, since that is what the site shows, over the link's own domain.
+func parsePurchaseLink(pl PurchaseLink) (AmazonLink, bool) {
+	al, ok := ParseAmazonLink(pl.Link)
+	if ok && al.Short {
+		if ResolveShortLink == nil {
+			return AmazonLink{}, false
+		}
+		full, err := ResolveShortLink(pl.Link)
+		if err != nil {
+			return AmazonLink{}, false
+		}
+		al, ok = ParseAmazonLink(full)
+	}
+	if !ok || al.Short {
+		return AmazonLink{}, false
+	}
+	if m, found := amazon.MarketplaceByVendor(pl.Vendor); found {
+		al.Domain = m.Domain
+	}
+	return al, true
+}
@@ -0,0 +1,93 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/acsellers/ln_shared/data"
+)
+
+func TestParseAmazonLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want data.AmazonLink
+		ok   bool
+	}{
+		{"https://www.amazon.com/dp/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.com"}, true},
+		{"https://www.amazon.com/Some-Title/dp/b000000001/ref=sr_1_1?keywords=x", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.com"}, true},
+		{"amazon.com/gp/product/0306406152", data.AmazonLink{ASIN: "0306406152", Domain: "amazon.com"}, true},
+		{"https://m.amazon.com/gp/aw/d/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.com"}, true},
+		{"http://www.amazon.com/exec/obidos/ASIN/0306406152", data.AmazonLink{ASIN: "0306406152", Domain: "amazon.com"}, true},
+		{"https://amzn.com/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.com"}, true},
+		{"https://www.amazon.com/gp/offer-listing?asin=B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.com"}, true},
+		{"https://www.amazon.co.uk/dp/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.co.uk"}, true},
+		{"https://www.amazon.co.jp/gp/product/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.co.jp"}, true},
+		{"https://amazon.ca/dp/B000000001", data.AmazonLink{ASIN: "B000000001", Domain: "amazon.ca"}, true},
+		{"https://amzn.to/3abcdef", data.AmazonLink{Short: true}, true},
+		{"https://a.co/d/abcdefg", data.AmazonLink{Short: true}, true},
+		{"https://www.amazon.com/dp/0306406153", data.AmazonLink{}, false},
+		{"https://www.amazon.com/s?k=light+novel", data.AmazonLink{}, false},
+		{"https://www.amazon.fr/dp/B000000001", data.AmazonLink{}, false},
+		{"https://www.barnesandnoble.com/dp/B000000001", data.AmazonLink{}, false},
+		{"https://amazon.com/%zz", data.AmazonLink{}, false},
+	}
+	for _, test := range tests {
+		got, ok := data.ParseAmazonLink(test.link)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", test.link, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestApplyAmazonLinks(t *testing.T) {
+	defer func(resolve func(string) (string, error)) { data.ResolveShortLink = resolve }(data.ResolveShortLink)
+	data.ResolveShortLink = func(link string) (string, error) {
+		if link == "https://amzn.to/print" {
+			return "https://www.amazon.com/dp/0306406152", nil
+		}
+		return "", errors.New("no redirect")
+	}
+
+	v := data.Volume{
+		PrintLinks: []data.PurchaseLink{
+			{Link: "https://amzn.to/print"},
+		},
+		DigitalLinks: []data.PurchaseLink{
+			{Link: "https://www.amazon.com/dp/B000000001"},
+			{Link: "https://www.amazon.com/dp/B000000002"},
+			{Link: "https://www.amazon.co.uk/dp/B000000003", Vendor: "Amazon UK"},
+			{Link: "https://amzn.to/broken"},
+		},
+		PurchaseLinks: []data.PurchaseLink{
+			{Link: "https://www.amazon.co.jp/dp/B000000004"},
+			{Link: "https://www.amazon.com/dp/B000000001"},
+		},
+	}
+	v.Amazon.HardcoverASIN = "0306406152"
+	v.Amazon.Set("amazon.co.jp", data.MarketplaceData{DigitalASIN: "B000000005"})
+
+	conflicts := v.ApplyAmazonLinks()
+	if v.Amazon.PaperbackASIN != "0306406152" || v.Amazon.DigitalASIN != "B000000001" {
+		t.Errorf("US: got paperback %q, digital %q", v.Amazon.PaperbackASIN, v.Amazon.DigitalASIN)
+	}
+	if uk := v.Amazon.In("amazon.co.uk"); uk.DigitalASIN != "B000000003" || uk.Currency != "GBP" {
+		t.Errorf("UK: got %+v", uk)
+	}
+
+	want := []data.FormatConflict{
+		{Domain: "amazon.com", Slot: data.SlotDigital, ASIN: "B000000001", Other: "B000000002"},
+		{Domain: "amazon.co.jp", Slot: data.SlotDigital, ASIN: "B000000005", Other: "B000000004"},
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("got %d conflicts, want %d: %+v", len(conflicts), len(want), conflicts)
+	}
+	for i, c := range conflicts {
+		if c.Reason == "" {
+			t.Errorf("conflict %d has no reason", i)
+		}
+		c.Reason = ""
+		if c != want[i] {
+			t.Errorf("conflict %d: got %+v, want %+v", i, c, want[i])
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package data
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+const (
+	SlotPaperback = "paperback"
+	SlotHardcover = "hardcover"
+	SlotDigital   = "digital"
+	SlotAudiobook = "audiobook"
+)
+
+// FormatSlot maps an Amazon format name onto the AmazonData slot it
+// belongs in, or "" for formats we do not track.
+func FormatSlot(format string) string {
+	for _, slot := range []struct {
+		name  string
+		types []string
+	}{
+		{SlotPaperback, amazon.PaperbackTypes},
+		{SlotHardcover, amazon.HardcoverTypes},
+		{SlotDigital, amazon.DigitalTypes},
+		{SlotAudiobook, amazon.AudiobookTypes},
+	} {
+		for _, t := range slot.types {
+			if strings.EqualFold(format, t) {
+				return slot.name
+			}
+		}
+	}
+	return ""
+}
+
+func (ad AmazonData) ASIN(slot string) string {
+	return ad.In(amazon.MarketplaceUS.Domain).asin(slot)
+}
+
+func (ad *AmazonData) SetASIN(slot, asin string) {
+	md := ad.In(amazon.MarketplaceUS.Domain)
+	md.set(slot, asin, 0)
+	ad.Set(amazon.MarketplaceUS.Domain, md)
+}
+
+// MatchCandidate is a search result, with the full product when it has
+// been looked up, which lets publisher and release date count.
+type MatchCandidate struct {
+	Result  amazon.SearchResult
+	Product *amazon.Product
+}
+
+type ASINSuggestion struct {
+	SeriesID   string   `json:"series_id"`
+	VolumeID   string   `json:"volume_id"`
+	Slot       string   `json:"slot"`
+	ASIN       string   `json:"asin"`
+	Title      string   `json:"title"`
+	Confidence float64  `json:"confidence"`
+	Reasons    []string `json:"reasons"`
+}
+
+// SuggestASINs searches Amazon for a volume missing its ASINs and scores
+// what comes back. The best verify candidates are looked up in full first,
+// at a credit each, so their publisher and release date can be checked.
+// Those lookups are skipped rather than spend the ledger's reserve.
+func SuggestASINs(c *amazon.Client, s Series, v Volume, verify int) ([]ASINSuggestion, error) {
+	author := ""
+	if authors := volumeAuthors(s, v); len(authors) > 0 {
+		author = authors[0]
+	}
+	results, err := c.Search(v.Title, author, s.Publisher)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]MatchCandidate, len(results))
+	for i, r := range results {
+		candidates[i] = MatchCandidate{Result: r}
+	}
+	if verify > 0 {
+		first := ScoreCandidates(s, v, candidates)
+		checked := map[string]bool{}
+		for _, sug := range first {
+			if len(checked) == verify {
+				break
+			}
+			checked[sug.ASIN] = true
+		}
+		for i := range candidates {
+			asin := candidates[i].Result.Asin
+			if !checked[asin] {
+				continue
+			}
+			// products already cached cost nothing and are still used
+			if _, _, err := c.Cache.Get(asin); err != nil && c.Ledger != nil && c.Ledger.Allow(false) != nil {
+				continue
+			}
+			pd, err := c.LookupASIN(asin, 30*24*time.Hour)
+			if err == nil {
+				p := amazon.NewProduct(pd)
+				candidates[i].Product = &p
+			}
+		}
+	}
+	return ScoreCandidates(s, v, candidates), nil
+}
+
+// ScoreCandidates rates each candidate as the paperback or digital edition
+// of v, best first. Candidates in other formats are left out.
+func ScoreCandidates(s Series, v Volume, candidates []MatchCandidate) []ASINSuggestion {
+	suggestions := []ASINSuggestion{}
+	for _, c := range candidates {
+		format := c.Result.Format()
+		if c.Product != nil && c.Product.Format != "" {
+			format = c.Product.Format
+		}
+		slot := FormatSlot(format)
+		if slot != SlotPaperback && slot != SlotDigital {
+			continue
+		}
+
+		sug := ASINSuggestion{
+			SeriesID: s.ID,
+			VolumeID: v.ID,
+			Slot:     slot,
+			ASIN:     c.Result.Asin,
+			Title:    c.Result.Title,
+		}
+		title, reasons := titleScore(v, c.Result.Title)
+		author, why := authorScore(volumeAuthors(s, v), c)
+		reasons = append(reasons, why)
+		publisher, why := publisherScore(s.Publisher, c)
+		reasons = append(reasons, why)
+		date, why := dateScore(v, slot, c)
+		sug.Reasons = append(reasons, why)
+
+		sug.Confidence = 0.5*title + 0.25*author + 0.1*publisher + 0.15*date
+		if c.Result.IsSponsored {
+			sug.Confidence -= 0.1
+			sug.Reasons = append(sug.Reasons, "sponsored result")
+		}
+		sug.Confidence = math.Max(0, math.Min(1, sug.Confidence))
+		suggestions = append(suggestions, sug)
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+	return suggestions
+}
+
+// AcceptSuggestions fills empty ASIN slots with the best suggestion at or
+// above minConfidence, it returns how many slots were filled.
+func AcceptSuggestions(series []Series, suggestions []ASINSuggestion, minConfidence float64) int {
+	best := map[string]ASINSuggestion{}
+	for _, sug := range suggestions {
+		if sug.Confidence < minConfidence {
+			continue
+		}
+		key := sug.SeriesID + "/" + sug.VolumeID + "/" + sug.Slot
+		if cur, ok := best[key]; !ok || sug.Confidence > cur.Confidence {
+			best[key] = sug
+		}
+	}
+
+	filled := 0
+	for i := range series {
+		for j := range series[i].Volumes {
+			v := &series[i].Volumes[j]
+			for _, slot := range []string{SlotPaperback, SlotDigital} {
+				sug, ok := best[series[i].ID+"/"+v.ID+"/"+slot]
+				if ok && v.Amazon.ASIN(slot) == "" {
+					v.Amazon.SetASIN(slot, sug.ASIN)
+					filled++
+				}
+			}
+		}
+	}
+	return filled
+}
+
+func volumeAuthors(s Series, v Volume) []string {
+	if len(v.Authors) > 0 {
+		return v.Authors
+	}
+	return s.Authors
+}
+
+func matchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+var volumeWords = map[string]bool{"vol": true, "volume": true, "light": true, "novel": true, "manga": true}
+
+func titleScore(v Volume, title string) (float64, []string) {
+	want := map[string]bool{}
+	for _, t := range matchTokens(v.Title) {
+		if !volumeWords[t] {
+			want[t] = true
+		}
+	}
+	got := map[string]bool{}
+	numbers := []int{}
+	for _, t := range matchTokens(title) {
+		got[t] = true
+		if n, err := strconv.Atoi(t); err == nil && n < 1000 {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(want) == 0 {
+		return 0, []string{"volume has no title"}
+	}
+	found := 0
+	for t := range want {
+		if got[t] {
+			found++
+		}
+	}
+	score := float64(found) / float64(len(want))
+	reasons := []string{strconv.Itoa(found) + " of " + strconv.Itoa(len(want)) + " title words"}
+
+	if v.Order > 0 && len(numbers) > 0 {
+		match := false
+		for _, n := range numbers {
+			if n == v.Order {
+				match = true
+			}
+		}
+		if match {
+			reasons = append(reasons, "volume number matches")
+		} else {
+			score *= 0.3
+			reasons = append(reasons, "different volume number")
+		}
+	}
+	return score, reasons
+}
+
+func authorScore(authors []string, c MatchCandidate) (float64, string) {
+	names := []string{}
+	for _, a := range c.Result.Authors {
+		names = append(names, a.Name)
+	}
+	if c.Product != nil {
+		names = append(names, c.Product.Authors()...)
+	}
+	if len(authors) == 0 || len(names) == 0 {
+		return 0.5, "no author to compare"
+	}
+	have := map[string]bool{}
+	for _, n := range names {
+		for _, t := range matchTokens(n) {
+			have[t] = true
+		}
+	}
+	for _, a := range authors {
+		tokens := matchTokens(a)
+		if len(tokens) > 0 && have[tokens[len(tokens)-1]] {
+			return 1, "author matches"
+		}
+	}
+	return 0, "author differs"
+}
+
+func publisherScore(publisher string, c MatchCandidate) (float64, string) {
+	if publisher == "" || c.Product == nil || c.Product.Publisher == "" {
+		return 0.5, "no publisher to compare"
+	}
+	want := strings.Join(matchTokens(publisher), "")
+	got := strings.Join(matchTokens(c.Product.Publisher), "")
+	if strings.Contains(got, want) || strings.Contains(want, got) {
+		return 1, "publisher matches"
+	}
+	return 0, "publisher differs"
+}
+
+func dateScore(v Volume, slot string, c MatchCandidate) (float64, string) {
+	release := v.PrintRelease
+	if slot == SlotDigital && v.DigitalRelease != "" {
+		release = v.DigitalRelease
+	}
+	if release == "" {
+		release = v.Release
+	}
+	want, err := time.Parse("2006-01-02", standardDate(release))
+	if release == "" || err != nil || c.Product == nil || c.Product.PublicationDate.IsZero() {
+		return 0.5, "no release date to compare"
+	}
+	days := math.Abs(c.Product.PublicationDate.Sub(want).Hours() / 24)
+	switch {
+	case days <= 7:
+		return 1, "release date matches"
+	case days <= 60:
+		return 0.5, "release date is close"
+	}
+	return 0, "release date differs"
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"sort"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// RatingPrior is what a volume or series is assumed to be rated before
+// any ratings come in, and how many ratings that assumption is worth. It
+// keeps a single five star rating from outranking hundreds of 4.7s.
+type RatingPrior struct {
+	Mean   float64
+	Weight float64
+}
+
+var DefaultRatingPrior = RatingPrior{Mean: 4.0, Weight: 25}
+
+func (rp RatingPrior) smooth(rating float64, count int) float64 {
+	n := float64(count)
+	if rp.Weight+n == 0 {
+		return 0
+	}
+	return (rp.Mean*rp.Weight + rating*n) / (rp.Weight + n)
+}
+
+type VolumeRating struct {
+	VolumeID string  `json:"volume_id"`
+	Title    string  `json:"title"`
+	Order    int     `json:"order"`
+	Rating   float64 `json:"rating"`
+	Ratings  int     `json:"ratings"`
+	Smoothed float64 `json:"smoothed"`
+	// Stars counts the ratings with 1 through 5 stars, at index 0 to 4.
+	Stars [5]int `json:"stars"`
+}
+
+type SeriesRating struct {
+	SeriesID string  `json:"series_id"`
+	Rating   float64 `json:"rating"`
+	Ratings  int     `json:"ratings"`
+	Smoothed float64 `json:"smoothed"`
+	Stars    [5]int  `json:"stars"`
+	// Volumes are in reading order, leaving out the ones without ratings,
+	// and make up the rating trend.
+	Volumes []VolumeRating `json:"volumes"`
+	// Trend is the least squares slope of the smoothed rating per volume.
+	Trend float64 `json:"trend"`
+}
+
+// RateSeries rolls the ratings of every ASIN of every volume in s, in all
+// marketplaces, up to the series. Amazon often shares one set of ratings
+// between the print and Kindle editions, so an ASIN with the same rating
+// and count as another of the same volume is only counted once.
+func RateSeries(s Series, products []amazon.ProductData, prior RatingPrior) SeriesRating {
+	byASIN := map[string]amazon.Product{}
+	for _, pd := range products {
+		if p := amazon.NewProduct(pd); p.ASIN != "" {
+			byASIN[p.ASIN] = p
+		}
+	}
+
+	sr := SeriesRating{SeriesID: s.ID, Volumes: []VolumeRating{}}
+	var sum float64
+	for _, v := range s.Volumes {
+		vr := rateVolume(v, byASIN)
+		if vr.Ratings == 0 {
+			continue
+		}
+		vr.Smoothed = prior.smooth(vr.Rating, vr.Ratings)
+		sr.Volumes = append(sr.Volumes, vr)
+		sr.Ratings += vr.Ratings
+		sum += vr.Rating * float64(vr.Ratings)
+		for i := range vr.Stars {
+			sr.Stars[i] += vr.Stars[i]
+		}
+	}
+	sort.SliceStable(sr.Volumes, func(i, j int) bool {
+		return sr.Volumes[i].Order < sr.Volumes[j].Order
+	})
+	if sr.Ratings > 0 {
+		sr.Rating = sum / float64(sr.Ratings)
+	}
+	sr.Smoothed = prior.smooth(sr.Rating, sr.Ratings)
+	sr.Trend = ratingTrend(sr.Volumes)
+	return sr
+}
+
+func rateVolume(v Volume, byASIN map[string]amazon.Product) VolumeRating {
+	vr := VolumeRating{VolumeID: v.ID, Title: v.Title, Order: v.Order}
+	domains := []string{amazon.MarketplaceUS.Domain}
+	for domain := range v.Amazon.Marketplaces {
+		domains = append(domains, domain)
+	}
+	type seen struct {
+		rating float64
+		count  int
+	}
+	counted := map[seen]bool{}
+	var sum float64
+	for _, domain := range domains {
+		for _, asin := range v.Amazon.In(domain).ASINs() {
+			p, ok := byASIN[asin]
+			if !ok || p.RatingsTotal == 0 || counted[seen{p.Rating, p.RatingsTotal}] {
+				continue
+			}
+			counted[seen{p.Rating, p.RatingsTotal}] = true
+			vr.Ratings += p.RatingsTotal
+			sum += p.Rating * float64(p.RatingsTotal)
+			for i := range p.Stars {
+				vr.Stars[i] += p.Stars[i]
+			}
+		}
+	}
+	if vr.Ratings > 0 {
+		vr.Rating = sum / float64(vr.Ratings)
+	}
+	return vr
+}
+
+func ratingTrend(volumes []VolumeRating) float64 {
+	n := float64(len(volumes))
+	if n < 2 {
+		return 0
+	}
+	var sx, sy, sxx, sxy float64
+	for i, vr := range volumes {
+		x := float64(i)
+		sx += x
+		sy += vr.Smoothed
+		sxx += x * x
+		sxy += x * vr.Smoothed
+	}
+	if d := n*sxx - sx*sx; d != 0 {
+		return (n*sxy - sx*sy) / d
+	}
+	return 0
+}
+
+// RatingPriorFor uses the mean of every rating across series as the prior,
+// with the given weight, so smoothing pulls toward what is typical for
+// the catalogue rather than a fixed guess.
+func RatingPriorFor(ratings []SeriesRating, weight float64) RatingPrior {
+	var sum float64
+	count := 0
+	for _, sr := range ratings {
+		sum += sr.Rating * float64(sr.Ratings)
+		count += sr.Ratings
+	}
+	if count == 0 {
+		return RatingPrior{Mean: DefaultRatingPrior.Mean, Weight: weight}
+	}
+	return RatingPrior{Mean: sum / float64(count), Weight: weight}
+}
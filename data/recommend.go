@@ -0,0 +1,165 @@
+package data
+
+import (
+	"math"
+	"sort"
+
+	"github.com/acsellers/ln_shared/amazon"
+)
+
+// Links from frequently bought together count for more than also bought,
+// Amazon only shows a couple of them and they are bought in one order.
+const (
+	alsoBoughtWeight     = 1.0
+	boughtTogetherWeight = 2.0
+)
+
+// CoPurchaseGraph links series whose books Amazon says are bought by the
+// same readers. Edges are undirected and weighted by how many links were
+// found between the two series' books.
+type CoPurchaseGraph struct {
+	edges  map[string]map[string]*coEdge
+	totals map[string]float64
+}
+
+type coEdge struct {
+	weight float64
+	links  int
+}
+
+type Recommendation struct {
+	SeriesID string  `json:"series_id"`
+	Weight   float64 `json:"weight"`
+	Links    int     `json:"links"`
+	// Score is Weight scaled down by how linked both series are overall,
+	// so a bestseller every product links to does not top every list.
+	Score float64 `json:"score"`
+}
+
+// BuildCoPurchaseGraph maps the also bought and frequently bought together
+// ASINs of products back to the series in catalog. Products and links
+// outside the catalog, and links within one series, are dropped.
+func BuildCoPurchaseGraph(catalog []Series, products []amazon.ProductData) *CoPurchaseGraph {
+	index := catalogASINs(catalog)
+	g := &CoPurchaseGraph{
+		edges:  map[string]map[string]*coEdge{},
+		totals: map[string]float64{},
+	}
+	for _, pd := range products {
+		p := amazon.NewProduct(pd)
+		from, ok := index[p.ASIN]
+		if !ok {
+			continue
+		}
+		for _, asin := range p.BoughtTogether {
+			g.link(from, index[asin], boughtTogetherWeight)
+		}
+		for _, asin := range p.AlsoBought {
+			g.link(from, index[asin], alsoBoughtWeight)
+		}
+	}
+	return g
+}
+
+// catalogASINs maps every ASIN of every volume, and the ISBN-10 of its
+// ISBNs which Amazon uses as the print ASIN, to the series.
+func catalogASINs(catalog []Series) map[string]string {
+	index := map[string]string{}
+	for _, s := range catalog {
+		for _, v := range s.Volumes {
+			domains := []string{amazon.MarketplaceUS.Domain}
+			for domain := range v.Amazon.Marketplaces {
+				domains = append(domains, domain)
+			}
+			for _, domain := range domains {
+				for _, asin := range v.Amazon.In(domain).ASINs() {
+					index[asin] = s.ID
+				}
+			}
+			for _, isbn := range []string{v.ISBN, v.DigitalISBN} {
+				if isbn10 := toISBN10(isbn); isbn10 != "" {
+					index[isbn10] = s.ID
+				}
+			}
+		}
+	}
+	return index
+}
+
+// toISBN10 converts a 978 ISBN-13, or cleans up an ISBN-10, returning ""
+// for anything else.
+func toISBN10(isbn string) string {
+	isbn = amazon.CleanGTIN(isbn)
+	if len(isbn) == 10 && amazon.ValidGTIN(isbn) {
+		return isbn
+	}
+	if len(isbn) != 13 || isbn[:3] != "978" || !amazon.ValidGTIN(isbn) {
+		return ""
+	}
+	body := isbn[3:12]
+	sum := 0
+	for i, r := range body {
+		sum += int(r-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X"
+	}
+	return body + string(rune('0'+check))
+}
+
+func (g *CoPurchaseGraph) link(a, b string, weight float64) {
+	if a == "" || b == "" || a == b {
+		return
+	}
+	g.add(a, b, weight)
+	g.add(b, a, weight)
+}
+
+func (g *CoPurchaseGraph) add(from, to string, weight float64) {
+	if g.edges[from] == nil {
+		g.edges[from] = map[string]*coEdge{}
+	}
+	e := g.edges[from][to]
+	if e == nil {
+		e = &coEdge{}
+		g.edges[from][to] = e
+	}
+	e.weight += weight
+	e.links++
+	g.totals[from] += weight
+}
+
+// ReadersAlsoRead returns up to n series linked to seriesID, best first,
+// or all of them when n is 0.
+func (g *CoPurchaseGraph) ReadersAlsoRead(seriesID string, n int) []Recommendation {
+	recs := []Recommendation{}
+	for to, e := range g.edges[seriesID] {
+		recs = append(recs, Recommendation{
+			SeriesID: to,
+			Weight:   e.weight,
+			Links:    e.links,
+			Score:    e.weight / math.Sqrt(g.totals[seriesID]*g.totals[to]),
+		})
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].SeriesID < recs[j].SeriesID
+	})
+	if n > 0 && len(recs) > n {
+		recs = recs[:n]
+	}
+	return recs
+}
+
+// Series lists the series with at least one link.
+func (g *CoPurchaseGraph) Series() []string {
+	ids := make([]string, 0, len(g.edges))
+	for id := range g.edges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
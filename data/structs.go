@@ -106,42 +106,118 @@ type AmazonData struct {
 	BookRank       int     `json:"book_rank"`
 	PhysicalRank   int     `json:"physical_rank"`
 	DigitalRank    int     `json:"digital_rank"`
+	// Everything but amazon.com, keyed by domain. The fields above are the
+	// amazon.com data.
+	Marketplaces map[string]MarketplaceData `json:"marketplaces,omitempty"`
+}
+type MarketplaceData struct {
+	Currency       string  `json:"currency"`
+	PaperbackASIN  string  `json:"paperback_asin"`
+	PaperbackPrice float32 `json:"paperback_price"`
+	DigitalASIN    string  `json:"digital_asin"`
+	DigitalPrice   float32 `json:"digital_price"`
+	HardcoverASIN  string  `json:"hardcover_asin"`
+	HardcoverPrice float32 `json:"hardcover_price"`
+	AudiobookASIN  string  `json:"audiobook_asin"`
+	AudiobookPrice float32 `json:"audiobook_price"`
+	BookRank       int     `json:"book_rank"`
+	PhysicalRank   int     `json:"physical_rank"`
+	DigitalRank    int     `json:"digital_rank"`
 }
 
-var (
-	currentFolder  = fmt.Sprintf("amazon/%s/", time.Now().Format("2006-01"))
-	previousFolder = fmt.Sprintf("amazon/%s/", time.Now().AddDate(0, 0, -1).Format("2006-01"))
-)
+// In returns the data for a marketplace domain, amazon.com comes from the
+// top level fields.
+func (ad AmazonData) In(domain string) MarketplaceData {
+	if domain == amazon.MarketplaceUS.Domain {
+		return MarketplaceData{
+			Currency:       amazon.MarketplaceUS.Currency,
+			PaperbackASIN:  ad.PaperbackASIN,
+			PaperbackPrice: ad.PaperbackPrice,
+			DigitalASIN:    ad.DigitalASIN,
+			DigitalPrice:   ad.DigitalPrice,
+			HardcoverASIN:  ad.HardcoverASIN,
+			HardcoverPrice: ad.HardcoverPrice,
+			AudiobookASIN:  ad.AudiobookASIN,
+			AudiobookPrice: ad.AudiobookPrice,
+			BookRank:       ad.BookRank,
+			PhysicalRank:   ad.PhysicalRank,
+			DigitalRank:    ad.DigitalRank,
+		}
+	}
+	return ad.Marketplaces[domain]
+}
 
-func (ad AmazonData) GetProductData() []amazon.ProductData {
+func (ad *AmazonData) Set(domain string, md MarketplaceData) {
+	if domain == amazon.MarketplaceUS.Domain {
+		ad.PaperbackASIN = md.PaperbackASIN
+		ad.PaperbackPrice = md.PaperbackPrice
+		ad.DigitalASIN = md.DigitalASIN
+		ad.DigitalPrice = md.DigitalPrice
+		ad.HardcoverASIN = md.HardcoverASIN
+		ad.HardcoverPrice = md.HardcoverPrice
+		ad.AudiobookASIN = md.AudiobookASIN
+		ad.AudiobookPrice = md.AudiobookPrice
+		ad.BookRank = md.BookRank
+		ad.PhysicalRank = md.PhysicalRank
+		ad.DigitalRank = md.DigitalRank
+		return
+	}
+	if ad.Marketplaces == nil {
+		ad.Marketplaces = map[string]MarketplaceData{}
+	}
+	ad.Marketplaces[domain] = md
+}
+
+func (md MarketplaceData) ASINs() []string {
 	asins := []string{}
-	if ad.PaperbackASIN != "" {
-		asins = append(asins, ad.PaperbackASIN)
+	if md.PaperbackASIN != "" {
+		asins = append(asins, md.PaperbackASIN)
+	}
+	if md.DigitalASIN != "" {
+		asins = append(asins, md.DigitalASIN)
+	}
+	if md.HardcoverASIN != "" {
+		asins = append(asins, md.HardcoverASIN)
 	}
-	if ad.DigitalASIN != "" {
-		asins = append(asins, ad.DigitalASIN)
+	return asins
+}
+
+// AmazonCache is where product data is read from, nil reads the cache
+// amazon.Default writes to.
+var AmazonCache *amazon.MonthlyCache
+
+func amazonCache() *amazon.MonthlyCache {
+	if AmazonCache == nil {
+		return amazon.DefaultCache()
 	}
-	if ad.HardcoverASIN != "" {
-		asins = append(asins, ad.HardcoverASIN)
+	return AmazonCache
+}
+
+func (ad AmazonData) GetProductData() []amazon.ProductData {
+	return ad.GetProductDataAt(time.Now())
+}
+
+// GetProductDataAt loads the freshest data stored at or before t.
+func (ad AmazonData) GetProductDataAt(t time.Time) []amazon.ProductData {
+	return loadProductData(ad.In(amazon.MarketplaceUS.Domain).ASINs(), amazonCache(), t)
+}
+
+// GetMarketplaceProductData loads the products for another marketplace,
+// which are cached in a subfolder named for the domain.
+func (ad AmazonData) GetMarketplaceProductData(domain string) []amazon.ProductData {
+	if domain == amazon.MarketplaceUS.Domain {
+		return ad.GetProductData()
 	}
+	return loadProductData(ad.In(domain).ASINs(), amazonCache().Sub(domain), time.Now())
+}
 
+func loadProductData(asins []string, cache *amazon.MonthlyCache, t time.Time) []amazon.ProductData {
 	ret := []amazon.ProductData{}
 	for _, asin := range asins {
-
-		data, err := os.ReadFile(currentFolder + asin + ".json")
+		pd, _, err := cache.LoadAt(asin, t)
 		if err != nil {
-			data, err = os.ReadFile(previousFolder + asin + ".json")
-			if err != nil {
-				log.Println("Error loading data for: ", asin)
-				log.Println(currentFolder + asin + ".json")
-				log.Println(err)
-				continue
-			}
-		}
-		var pd amazon.ProductData
-		err = json.Unmarshal(data, &pd)
-		if err != nil {
-			log.Println("Error unmarshalling data for: ", asin)
+			log.Println("Error loading data for: ", asin)
+			log.Println(err)
 			continue
 		}
 		ret = append(ret, pd)
@@ -162,6 +238,24 @@ func (v Volume) HasReleased() bool {
 	}
 	return false
 }
+
+// HintAmazonRelease tells c when the volume releases, so its ISBNs and
+// ASINs are retried more often while it is a preorder.
+func (v Volume) HintAmazonRelease(c *amazon.Client) {
+	dates := v.ReleaseDates()
+	sort.Strings(dates)
+	release, err := time.Parse("2006-01-02", dates[0])
+	if err != nil || dates[0] == "2099-12-31" {
+		return
+	}
+	ids := append([]string{v.ISBN, v.DigitalISBN}, v.Amazon.In(amazon.MarketplaceUS.Domain).ASINs()...)
+	for _, id := range ids {
+		if id != "" {
+			c.HintRelease(id, release)
+		}
+	}
+}
+
 func (v *Volume) ReleaseDates() []string {
 	ret := []string{}
 	if len(v.DigitalRelease) == 4 {